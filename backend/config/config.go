@@ -1,67 +1,230 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"blog-suiseiseki/logging"
 )
 
 type Config struct {
 	// Server
 	Port string
 	Mode string // "dev" or "prod"
+	// Unix socket to listen on instead of Port, e.g. for a reverse proxy on the same host
+	SocketPath string
+	// How long SIGINT/SIGTERM waits for in-flight requests and syncs before cancelling them
+	ShutdownTimeoutSeconds int
 
 	// Database
 	DBPath string
 
 	// Posts
-	PostsPath    string
+	PostsPath      string
 	PostsRemoteURL string // Remote repo URL to clone when posts dir is empty (e.g. https://github.com/xxx/blog-posts.git)
+	PostsBranch    string // Remote branch served in prod; empty = branch checked out by the clone
+	PostsType      string // Content source kind: git (default), dir, archive or s3
+	PostsS3        S3Bucket
+
+	// Webhook (GitHub, GitLab, Gitea/Forgejo, Bitbucket)
+	WebhookSecret    string
+	WebhookBranch    string   // Only pushes to this branch sync; empty = repository default branch
+	WebhookProviders []string // Accepted providers: github, gitlab, gitea, forgejo, bitbucket
+	GitRepoPath      string   // Production path to the posts repo on the server
+
+	// Content sources merged into one blog; without a sources list the posts and webhook
+	// settings above form a single source named DefaultSourceName
+	Sources []ContentSource
+
+	// Branch previews: pushes to other branches are cloned and indexed under PreviewPath
+	PreviewEnabled bool
+	PreviewPath    string
+	PreviewMax     int // previews kept; more drop the least recently used
+
+	// "Edit this page" / history links: provider templates or explicit URL templates
+	SourceProvider        string
+	SourceURLTemplate     string
+	SourceHistoryTemplate string
 
-	// GitHub Webhook
-	WebhookSecret string
-	GitRepoPath   string // Production path to the posts repo on the server
+	// Admin API bearer token; empty = admin API open in dev, disabled in prod
+	AdminToken string
 
-	// Sync: git pull interval (minutes); 0 = disabled
+	// Sync: fetch + reset interval (minutes); 0 = disabled
 	SyncIntervalMinutes int
+	// Timeout for a single git clone/fetch (seconds)
+	GitTimeoutSeconds int
+	// Git implementation: "go-git" (in-process) or "exec" (git binary)
+	GitBackend string
+	// Delete untracked files in the posts dir after resetting to the remote
+	SyncCleanUntracked bool
+	// How many recently synced commits can be rolled back to
+	RollbackDepth int
+
+	// Origins besides the blog's own allowed to open /api/ws (e.g. sites embedding a widget); "*" = any
+	WSAllowedOrigins []string
+
+	// Outbound webhooks notified of post and sync events (chat bots, CI)
+	NotifyWebhooks []NotifyWebhook
+
+	// Prometheus /metrics: served on the main port when enabled, or on MetricsListen (e.g.
+	// 127.0.0.1:9464) only; MetricsToken requires "Authorization: Bearer <token>"
+	MetricsEnabled bool
+	MetricsListen  string
+	MetricsToken   string
+
+	// Logging: "text" or "json"; level debug, info, warn or error, overridden per component
+	// (e.g. sync: debug)
+	LogFormat string
+	LogLevel  string
+	LogLevels map[string]string
 
 	// Frontend dev server port (for scripts / docs)
 	FrontendPort string
 
 	// Environment
 	IsDev bool
+
+	// Where values came from, for PrintEffective: the config file read, the keys it sets and
+	// the env vars applied
+	file     string
+	fileKeys map[string]bool
+	envVars  map[string]bool
+}
+
+// DefaultSourceName names the single source built from the posts settings.
+const DefaultSourceName = "default"
+
+// ContentSource is one posts repo (or local dir) whose posts are merged into the blog.
+type ContentSource struct {
+	Name          string   `yaml:"name"`
+	Type          string   `yaml:"type"`       // git (default), dir, archive or s3
+	Path          string   `yaml:"path"`       // local dir; archive and s3 content is mirrored here
+	RemoteURL     string   `yaml:"remote_url"` // git remote, or the .tar.gz/.zip URL for type archive
+	Branch        string   `yaml:"branch"`
+	WebhookSecret string   `yaml:"webhook_secret"` // secret for /api/webhook/<name>
+	WebhookBranch string   `yaml:"webhook_branch"` // only pushes to this branch sync; empty = Branch
+	SlugPrefix    string   `yaml:"slug_prefix"`    // prepended to every slug from this source
+	Category      string   `yaml:"category"`       // category for posts without one in front-matter
+	S3            S3Bucket `yaml:"s3"`
+}
+
+// S3Bucket locates the content of a source with type s3 in an S3-compatible bucket.
+type S3Bucket struct {
+	Endpoint  string `yaml:"endpoint"` // e.g. https://s3.amazonaws.com or http://127.0.0.1:9000 (MinIO)
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"` // empty = anonymous requests
+	SecretKey string `yaml:"secret_key"`
+}
+
+// NotifyWebhook is a URL the blog POSTs signed event JSON to.
+type NotifyWebhook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // HMAC-SHA256 key for X-Blog-Signature-256; empty = unsigned
+	Events []string `yaml:"events"` // e.g. post_created, sync_failed; empty = post_* and sync_failed
 }
 
 // configFile mirrors config.yaml structure.
 type configFile struct {
-	Server   struct { Port string `yaml:"port"`; Mode string `yaml:"mode"` }
-	Database struct { Path string `yaml:"path"` }
-	Posts    struct {
-		Path      string `yaml:"path"`
-		RemoteURL string `yaml:"remote_url"`
+	Server struct {
+		Port                   string `yaml:"port"`
+		Mode                   string `yaml:"mode"`
+		Socket                 string `yaml:"socket"`
+		ShutdownTimeoutSeconds int    `yaml:"shutdown_timeout_seconds"`
 	}
-	Webhook  struct {
-		Secret      string `yaml:"secret"`
-		GitRepoPath string `yaml:"git_repo_path"`
+	Database struct {
+		Path string `yaml:"path"`
+	}
+	Posts struct {
+		Path      string   `yaml:"path"`
+		RemoteURL string   `yaml:"remote_url"`
+		Branch    string   `yaml:"branch"`
+		Type      string   `yaml:"type"`
+		S3        S3Bucket `yaml:"s3"`
+	}
+	Webhook struct {
+		Secret      string   `yaml:"secret"`
+		Branch      string   `yaml:"branch"`
+		Providers   []string `yaml:"providers"`
+		GitRepoPath string   `yaml:"git_repo_path"`
+	}
+	Sources []ContentSource `yaml:"sources"`
+	Preview struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+		Max     int    `yaml:"max"`
+	}
+	SourceLinks struct {
+		Provider        string `yaml:"provider"`
+		SourceTemplate  string `yaml:"source_template"`
+		HistoryTemplate string `yaml:"history_template"`
+	} `yaml:"source_links"`
+	Admin struct {
+		Token string `yaml:"token"`
+	}
+	Sync struct {
+		IntervalMinutes   int    `yaml:"interval_minutes"`
+		GitTimeoutSeconds int    `yaml:"git_timeout_seconds"`
+		GitBackend        string `yaml:"git_backend"`
+		CleanUntracked    bool   `yaml:"clean_untracked"`
+		RollbackDepth     int    `yaml:"rollback_depth"`
+	}
+	WebSocket struct {
+		AllowedOrigins []string `yaml:"allowed_origins"`
+	} `yaml:"websocket"`
+	Notify struct {
+		Webhooks []NotifyWebhook `yaml:"webhooks"`
+	}
+	Log struct {
+		Format string            `yaml:"format"`
+		Level  string            `yaml:"level"`
+		Levels map[string]string `yaml:"levels"`
+	}
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
 	}
-	Sync    struct { IntervalMinutes int `yaml:"interval_minutes"` }
 	Frontend struct {
 		Port       string `yaml:"port"`
 		APIBaseURL string `yaml:"api_base_url"`
 	}
 }
 
-func Load() *Config {
+// Load merges defaults, the first config.yaml found and environment variables. A config
+// file that cannot be parsed, unknown keys and malformed env values are errors; see Validate
+// for checks on the merged values.
+func Load() (*Config, error) {
 	cfg := &Config{
-		Port:                "8080",
-		Mode:                "dev",
-		DBPath:              "./blog.db",
-		PostsPath:           "../posts",
-		WebhookSecret:       "",
-		GitRepoPath:         "",
-		SyncIntervalMinutes: 0,
+		Port:                   "8080",
+		ShutdownTimeoutSeconds: 30,
+		Mode:                   "dev",
+		DBPath:                 "./blog.db",
+		PostsPath:              "../posts",
+		WebhookSecret:          "",
+		WebhookProviders:       []string{"github"},
+		GitRepoPath:            "",
+		PreviewPath:            "./previews",
+		PreviewMax:             10,
+		SyncIntervalMinutes:    0,
+		GitTimeoutSeconds:      120,
+		GitBackend:             "go-git",
+		RollbackDepth:          10,
+		LogFormat:              "text",
+		LogLevel:               "info",
 	}
 
 	// 1. Load defaults from config.yaml
@@ -70,25 +233,39 @@ func Load() *Config {
 		"./config.yaml",
 		"../config.yaml",
 	}
-	for _, p := range configPaths {
+	for i, p := range configPaths {
 		if p == "" {
 			continue
 		}
 		abs, _ := filepath.Abs(p)
 		data, err := os.ReadFile(abs)
-		if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && i > 0 {
 			continue
 		}
-		var f configFile
-		if err := yaml.Unmarshal(data, &f); err != nil {
-			continue
+		if err != nil {
+			return nil, fmt.Errorf("read config failed: %w", err)
+		}
+		f, keys, err := parseFile(data)
+		if err == nil {
+			err = f.resolveSecrets()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", abs, err)
 		}
+		cfg.file = abs
+		cfg.fileKeys = keys
 		if f.Server.Port != "" {
 			cfg.Port = f.Server.Port
 		}
 		if f.Server.Mode != "" {
 			cfg.Mode = f.Server.Mode
 		}
+		if f.Server.Socket != "" {
+			cfg.SocketPath = f.Server.Socket
+		}
+		if f.Server.ShutdownTimeoutSeconds != 0 {
+			cfg.ShutdownTimeoutSeconds = f.Server.ShutdownTimeoutSeconds
+		}
 		if f.Database.Path != "" {
 			cfg.DBPath = f.Database.Path
 		}
@@ -98,15 +275,88 @@ func Load() *Config {
 		if f.Posts.RemoteURL != "" {
 			cfg.PostsRemoteURL = f.Posts.RemoteURL
 		}
+		if f.Posts.Branch != "" {
+			cfg.PostsBranch = f.Posts.Branch
+		}
+		if f.Posts.Type != "" {
+			cfg.PostsType = f.Posts.Type
+		}
+		cfg.PostsS3 = f.Posts.S3
 		if f.Webhook.Secret != "" {
 			cfg.WebhookSecret = f.Webhook.Secret
 		}
+		if f.Webhook.Branch != "" {
+			cfg.WebhookBranch = f.Webhook.Branch
+		}
+		if len(f.Webhook.Providers) > 0 {
+			cfg.WebhookProviders = f.Webhook.Providers
+		}
 		if f.Webhook.GitRepoPath != "" {
 			cfg.GitRepoPath = f.Webhook.GitRepoPath
 		}
-		if f.Sync.IntervalMinutes > 0 {
+		if len(f.Sources) > 0 {
+			cfg.Sources = f.Sources
+		}
+		if f.Preview.Enabled {
+			cfg.PreviewEnabled = true
+		}
+		if f.Preview.Path != "" {
+			cfg.PreviewPath = f.Preview.Path
+		}
+		if f.Preview.Max != 0 {
+			cfg.PreviewMax = f.Preview.Max
+		}
+		if f.SourceLinks.Provider != "" {
+			cfg.SourceProvider = f.SourceLinks.Provider
+		}
+		if f.SourceLinks.SourceTemplate != "" {
+			cfg.SourceURLTemplate = f.SourceLinks.SourceTemplate
+		}
+		if f.SourceLinks.HistoryTemplate != "" {
+			cfg.SourceHistoryTemplate = f.SourceLinks.HistoryTemplate
+		}
+		if f.Admin.Token != "" {
+			cfg.AdminToken = f.Admin.Token
+		}
+		if f.Sync.IntervalMinutes != 0 {
 			cfg.SyncIntervalMinutes = f.Sync.IntervalMinutes
 		}
+		if f.Sync.GitTimeoutSeconds != 0 {
+			cfg.GitTimeoutSeconds = f.Sync.GitTimeoutSeconds
+		}
+		if f.Sync.GitBackend != "" {
+			cfg.GitBackend = f.Sync.GitBackend
+		}
+		if f.Sync.CleanUntracked {
+			cfg.SyncCleanUntracked = true
+		}
+		if f.Sync.RollbackDepth != 0 {
+			cfg.RollbackDepth = f.Sync.RollbackDepth
+		}
+		if len(f.WebSocket.AllowedOrigins) > 0 {
+			cfg.WSAllowedOrigins = f.WebSocket.AllowedOrigins
+		}
+		if len(f.Notify.Webhooks) > 0 {
+			cfg.NotifyWebhooks = f.Notify.Webhooks
+		}
+		if f.Log.Format != "" {
+			cfg.LogFormat = f.Log.Format
+		}
+		if f.Log.Level != "" {
+			cfg.LogLevel = f.Log.Level
+		}
+		if len(f.Log.Levels) > 0 {
+			cfg.LogLevels = f.Log.Levels
+		}
+		if f.Metrics.Enabled {
+			cfg.MetricsEnabled = true
+		}
+		if f.Metrics.Listen != "" {
+			cfg.MetricsListen = f.Metrics.Listen
+		}
+		if f.Metrics.Token != "" {
+			cfg.MetricsToken = f.Metrics.Token
+		}
 		if f.Frontend.Port != "" {
 			cfg.FrontendPort = f.Frontend.Port
 		}
@@ -114,23 +364,82 @@ func Load() *Config {
 	}
 
 	// 2. Environment variables override
-	if v := os.Getenv("PORT"); v != "" {
+	cfg.envVars = make(map[string]bool)
+	var errs []error
+	env := func(name string) string {
+		v := os.Getenv(name)
+		if v != "" {
+			cfg.envVars[name] = true
+		}
+		return v
+	}
+	envInt := func(name string, dst *int) {
+		if v := env(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	envBool := func(name string, dst *bool) {
+		if v := env(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	// A secret is set directly or, with the _FILE suffix, read from a file (Docker secrets,
+	// systemd credentials)
+	envSecret := func(name string, dst *string) {
+		v, path := env(name), env(name+"_FILE")
+		switch {
+		case v != "" && path != "":
+			errs = append(errs, fmt.Errorf("%s and %s_FILE are both set, use one", name, name))
+		case v != "":
+			*dst = v
+		case path != "":
+			s, err := readSecretFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", name, err))
+				return
+			}
+			*dst = s
+		}
+	}
+	if v := env("PORT"); v != "" {
 		cfg.Port = v
 	}
-	if v := os.Getenv("MODE"); v != "" {
+	if v := env("MODE"); v != "" {
 		cfg.Mode = v
 	}
-	if v := os.Getenv("DB_PATH"); v != "" {
+	if v := env("SOCKET_PATH"); v != "" {
+		cfg.SocketPath = v
+	}
+	envInt("SHUTDOWN_TIMEOUT_SECONDS", &cfg.ShutdownTimeoutSeconds)
+	if v := env("DB_PATH"); v != "" {
 		cfg.DBPath = v
 	}
-	if v := os.Getenv("POSTS_PATH"); v != "" {
+	if v := env("POSTS_PATH"); v != "" {
 		cfg.PostsPath = v
 	}
-	if v := os.Getenv("POSTS_REMOTE_URL"); v != "" {
+	if v := env("POSTS_REMOTE_URL"); v != "" {
 		cfg.PostsRemoteURL = v
 	}
+	if v := env("POSTS_BRANCH"); v != "" {
+		cfg.PostsBranch = v
+	}
+	if v := env("POSTS_TYPE"); v != "" {
+		cfg.PostsType = v
+	}
+	envSecret("POSTS_S3_ACCESS_KEY", &cfg.PostsS3.AccessKey)
+	envSecret("POSTS_S3_SECRET_KEY", &cfg.PostsS3.SecretKey)
 	if cfg.Mode != "dev" && (cfg.PostsPath == "" || cfg.PostsPath == "../posts") {
-		if v := os.Getenv("GIT_REPO_PATH"); v != "" {
+		if v := env("GIT_REPO_PATH"); v != "" {
 			cfg.PostsPath = v
 		} else if cfg.GitRepoPath != "" {
 			cfg.PostsPath = cfg.GitRepoPath
@@ -138,31 +447,275 @@ func Load() *Config {
 			cfg.PostsPath = "/var/lib/blog/posts"
 		}
 	}
-	if v := os.Getenv("WEBHOOK_SECRET"); v != "" {
-		cfg.WebhookSecret = v
+	envSecret("WEBHOOK_SECRET", &cfg.WebhookSecret)
+	if v := env("WEBHOOK_BRANCH"); v != "" {
+		cfg.WebhookBranch = v
+	}
+	if v := env("WEBHOOK_PROVIDERS"); v != "" {
+		cfg.WebhookProviders = strings.Split(v, ",")
 	}
-	if v := os.Getenv("GIT_REPO_PATH"); v != "" {
+	if v := env("GIT_REPO_PATH"); v != "" {
 		cfg.GitRepoPath = v
 	}
-	if v := os.Getenv("SYNC_INTERVAL_MINUTES"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-			cfg.SyncIntervalMinutes = n
+	envBool("PREVIEW_ENABLED", &cfg.PreviewEnabled)
+	if v := env("PREVIEW_PATH"); v != "" {
+		cfg.PreviewPath = v
+	}
+	envInt("PREVIEW_MAX", &cfg.PreviewMax)
+	if v := env("SOURCE_LINKS_PROVIDER"); v != "" {
+		cfg.SourceProvider = v
+	}
+	if v := env("SOURCE_LINKS_SOURCE_TEMPLATE"); v != "" {
+		cfg.SourceURLTemplate = v
+	}
+	if v := env("SOURCE_LINKS_HISTORY_TEMPLATE"); v != "" {
+		cfg.SourceHistoryTemplate = v
+	}
+	envSecret("ADMIN_TOKEN", &cfg.AdminToken)
+	envInt("SYNC_INTERVAL_MINUTES", &cfg.SyncIntervalMinutes)
+	envInt("GIT_TIMEOUT_SECONDS", &cfg.GitTimeoutSeconds)
+	if v := env("GIT_BACKEND"); v != "" {
+		cfg.GitBackend = v
+	}
+	envBool("SYNC_CLEAN_UNTRACKED", &cfg.SyncCleanUntracked)
+	envInt("SYNC_ROLLBACK_DEPTH", &cfg.RollbackDepth)
+	if v := env("WS_ALLOWED_ORIGINS"); v != "" {
+		cfg.WSAllowedOrigins = strings.Split(v, ",")
+	}
+	// NOTIFY_WEBHOOK_URLS replaces notify.webhooks; every URL gets the default events
+	if v := env("NOTIFY_WEBHOOK_URLS"); v != "" {
+		cfg.NotifyWebhooks = nil
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				cfg.NotifyWebhooks = append(cfg.NotifyWebhooks, NotifyWebhook{URL: u})
+			}
 		}
 	}
-	if v := os.Getenv("FRONTEND_PORT"); v != "" {
+	var notifySecret string
+	envSecret("NOTIFY_WEBHOOK_SECRET", &notifySecret)
+	if notifySecret != "" {
+		for i := range cfg.NotifyWebhooks {
+			cfg.NotifyWebhooks[i].Secret = notifySecret
+		}
+	}
+	if v := env("LOG_FORMAT"); v != "" {
+		cfg.LogFormat = v
+	}
+	if v := env("LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+	// LOG_LEVELS=sync=debug,http=warn
+	if v := env("LOG_LEVELS"); v != "" {
+		levels, err := logging.ParseComponentLevels(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("LOG_LEVELS: %w", err))
+		}
+		cfg.LogLevels = levels
+	}
+	envBool("METRICS_ENABLED", &cfg.MetricsEnabled)
+	if v := env("METRICS_LISTEN"); v != "" {
+		cfg.MetricsListen = v
+	}
+	envSecret("METRICS_TOKEN", &cfg.MetricsToken)
+	if v := env("FRONTEND_PORT"); v != "" {
 		cfg.FrontendPort = v
 	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
+	// A separate metrics address implies metrics are wanted
+	if cfg.MetricsListen != "" {
+		cfg.MetricsEnabled = true
+	}
 	cfg.IsDev = cfg.Mode == "dev"
+	// Webhooks follow the served branch unless configured separately
+	if cfg.WebhookBranch == "" {
+		cfg.WebhookBranch = cfg.PostsBranch
+	}
 	if cfg.FrontendPort == "" {
 		cfg.FrontendPort = "3000"
 	}
 
-	// 3. Resolve posts path to absolute
+	// 3. Resolve posts and preview paths to absolute
 	absPostsPath, err := filepath.Abs(cfg.PostsPath)
 	if err == nil {
 		cfg.PostsPath = absPostsPath
 	}
+	if len(cfg.Sources) == 0 {
+		cfg.Sources = []ContentSource{{
+			Name:          DefaultSourceName,
+			Type:          cfg.PostsType,
+			Path:          cfg.PostsPath,
+			RemoteURL:     cfg.PostsRemoteURL,
+			Branch:        cfg.PostsBranch,
+			WebhookSecret: cfg.WebhookSecret,
+			WebhookBranch: cfg.WebhookBranch,
+			S3:            cfg.PostsS3,
+		}}
+	}
+	for i := range cfg.Sources {
+		if cfg.Sources[i].Type == "" {
+			cfg.Sources[i].Type = "git"
+		}
+		if cfg.Sources[i].WebhookBranch == "" {
+			cfg.Sources[i].WebhookBranch = cfg.Sources[i].Branch
+		}
+		if cfg.Sources[i].Path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(cfg.Sources[i].Path); err == nil {
+			cfg.Sources[i].Path = abs
+		}
+	}
+	if absPreviewPath, err := filepath.Abs(cfg.PreviewPath); err == nil {
+		cfg.PreviewPath = absPreviewPath
+	}
+
+	return cfg, nil
+}
+
+// unknownField matches yaml.v3's error for a key KnownFields rejects.
+var unknownField = regexp.MustCompile(`field (\S+) not found in type .*`)
+
+// parseFile decodes config.yaml, rejecting unknown keys, and returns the dotted keys the file
+// sets, e.g. "server.port"; a list such as "sources" is one key.
+func parseFile(data []byte) (configFile, map[string]bool, error) {
+	var f configFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for i, e := range typeErr.Errors {
+				typeErr.Errors[i] = unknownField.ReplaceAllString(e, "unknown key $1")
+			}
+		}
+		return f, nil, err
+	}
 
-	return cfg
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return f, nil, err
+	}
+	keys := make(map[string]bool)
+	collectKeys(&root, "", keys)
+	return f, keys, nil
+}
+
+func collectKeys(n *yaml.Node, prefix string, keys map[string]bool) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			collectKeys(c, prefix, keys)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			collectKeys(n.Content[i+1], key, keys)
+		}
+	default:
+		if prefix != "" {
+			keys[prefix] = true
+		}
+	}
+}
+
+// Validate reports configuration errors that would leave the server unable to start, or
+// running in an unsafe or surprising way; all of them at once, one per line.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Mode != "dev" && c.Mode != "prod" {
+		fail("server.mode: %q must be dev or prod", c.Mode)
+	}
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		fail("server.port: %q must be a port number between 1 and 65535", c.Port)
+	}
+	if c.ShutdownTimeoutSeconds <= 0 {
+		fail("server.shutdown_timeout_seconds: must be positive, got %d", c.ShutdownTimeoutSeconds)
+	}
+	if c.SyncIntervalMinutes < 0 {
+		fail("sync.interval_minutes: must be 0 (disabled) or positive, got %d", c.SyncIntervalMinutes)
+	}
+	if c.GitTimeoutSeconds <= 0 {
+		fail("sync.git_timeout_seconds: must be positive, got %d", c.GitTimeoutSeconds)
+	}
+	if c.RollbackDepth <= 0 {
+		fail("sync.rollback_depth: must be positive, got %d", c.RollbackDepth)
+	}
+	if c.GitBackend != "go-git" && c.GitBackend != "exec" {
+		fail("sync.git_backend: %q must be go-git or exec", c.GitBackend)
+	}
+
+	names := make(map[string]bool)
+	paths := make(map[string]string)
+	for i, src := range c.Sources {
+		switch {
+		case src.Name == "":
+			fail("sources[%d]: name is required", i)
+			continue
+		case strings.ContainsAny(src.Name, "/?#% "):
+			fail("sources[%d]: name %q must be URL-safe", i, src.Name)
+		case names[src.Name]:
+			fail("sources[%d]: duplicate name %q", i, src.Name)
+		case src.Path == "":
+			fail("source %s: path is required", src.Name)
+		case src.Type != "git" && src.Type != "dir" && src.Type != "archive" && src.Type != "s3":
+			fail("source %s: unknown type %q (want git, dir, archive or s3)", src.Name, src.Type)
+		case src.Type == "archive" && src.RemoteURL == "":
+			fail("source %s: type archive requires remote_url (the archive URL)", src.Name)
+		case src.Type == "s3" && (src.S3.Endpoint == "" || src.S3.Bucket == ""):
+			fail("source %s: type s3 requires s3.endpoint and s3.bucket", src.Name)
+		case src.Type == "git" && c.Mode == "prod" && src.WebhookSecret == "":
+			// Anyone could trigger syncs through an unsigned webhook
+			if len(c.Sources) == 1 && src.Name == DefaultSourceName {
+				fail("webhook.secret: required in prod (or set WEBHOOK_SECRET)")
+			} else {
+				fail("source %s: webhook_secret is required in prod", src.Name)
+			}
+		}
+		if other, ok := paths[src.Path]; ok && src.Path != "" {
+			fail("source %s: path %s is already used by source %s", src.Name, src.Path, other)
+		}
+		names[src.Name] = true
+		paths[src.Path] = src.Name
+	}
+	if c.PreviewEnabled && len(c.Sources) > 0 && c.Sources[0].Type != "git" {
+		fail("preview.enabled requires the first content source to be a git repo")
+	}
+	if c.PreviewMax <= 0 {
+		fail("preview.max: must be positive, got %d", c.PreviewMax)
+	}
+	for i, hook := range c.NotifyWebhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("notify.webhooks[%d]: url %q must be an http(s) URL", i, hook.URL)
+		}
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		fail("log.format: %q must be text or json", c.LogFormat)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		fail("log.level: %v", err)
+	}
+	for comp, level := range c.LogLevels {
+		if _, err := logging.ParseLevel(level); err != nil {
+			fail("log.levels.%s: %v", comp, err)
+		}
+	}
+	if c.MetricsListen != "" {
+		if _, port, err := net.SplitHostPort(c.MetricsListen); err != nil || port == "" {
+			fail("metrics.listen: %q must be host:port, e.g. 127.0.0.1:9464", c.MetricsListen)
+		}
+	} else if c.MetricsEnabled && c.Mode == "prod" && c.MetricsToken == "" {
+		// The main port is usually public behind the reverse proxy
+		fail("metrics.token: required in prod when /metrics is served on the main port (or set metrics.listen)")
+	}
+	return errors.Join(errs...)
 }
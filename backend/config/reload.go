@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"blog-suiseiseki/logging"
+)
+
+var configLog = logging.New("config")
+
+// liveKeys are the settings a running server applies on reload; everything else needs a restart.
+var liveKeys = map[string]bool{
+	"sync.interval_minutes": true,
+	"webhook.secret":        true,
+	"log.level":             true,
+	"log.levels":            true,
+}
+
+// File returns the path of the config file read, empty when none was found.
+func (c *Config) File() string {
+	return c.file
+}
+
+// Changes compares a reloaded config with the running one. live lists the changed settings
+// a running server can apply; restart those that only take effect after a restart.
+func Changes(old, next *Config) (live, restart []string) {
+	for _, f := range fields {
+		if reflect.DeepEqual(f.value(old), f.value(next)) {
+			continue
+		}
+		if liveKeys[f.key] {
+			live = append(live, f.key)
+		} else {
+			restart = append(restart, f.key)
+		}
+	}
+
+	// Webhook secrets of sources change live, the rest of a source does not
+	if len(old.Sources) != len(next.Sources) {
+		restart = append(restart, "sources")
+	} else {
+		for i := range old.Sources {
+			a, b := old.Sources[i], next.Sources[i]
+			if a.WebhookSecret != b.WebhookSecret && (len(next.Sources) > 1 || b.Name != DefaultSourceName) {
+				live = append(live, fmt.Sprintf("sources[%s].webhook_secret", b.Name))
+			}
+			a.WebhookSecret, b.WebhookSecret = "", ""
+			if !reflect.DeepEqual(a, b) && !(len(next.Sources) == 1 && b.Name == DefaultSourceName) {
+				restart = append(restart, fmt.Sprintf("sources[%s]", b.Name))
+			}
+		}
+	}
+	if !reflect.DeepEqual(old.NotifyWebhooks, next.NotifyWebhooks) {
+		restart = append(restart, "notify.webhooks")
+	}
+	return live, restart
+}
+
+// ApplyLive returns running with the live settings taken from next: the config in effect
+// after a reload, against which the next reload is compared.
+func ApplyLive(running, next *Config) *Config {
+	applied := *running
+	applied.SyncIntervalMinutes = next.SyncIntervalMinutes
+	applied.WebhookSecret = next.WebhookSecret
+	applied.LogLevel = next.LogLevel
+	applied.LogLevels = next.LogLevels
+	applied.Sources = append([]ContentSource(nil), running.Sources...)
+	for i := range applied.Sources {
+		for _, src := range next.Sources {
+			if src.Name == applied.Sources[i].Name {
+				applied.Sources[i].WebhookSecret = src.WebhookSecret
+			}
+		}
+	}
+	return &applied
+}
+
+// WatchFile calls onChange after path was written, debounced, until ctx is done. The directory
+// is watched since editors often replace the file instead of writing it.
+func WatchFile(ctx context.Context, path string, debounce time.Duration, onChange func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch config failed: %w", err)
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("watch config failed: %w", err)
+	}
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(ev.Name) == filepath.Clean(path) && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				fire = time.After(debounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			configLog.Warn("watch config failed", "error", err)
+		case <-fire:
+			fire = nil
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secret values in config.yaml may reference where the secret lives instead of holding it:
+//
+//	webhook:
+//	  secret: file:/run/secrets/webhook_secret   # read from a file, e.g. a Docker secret
+//	admin:
+//	  token: env:BLOG_ADMIN_TOKEN                 # read from another env var
+//
+// Relative file paths, in config.yaml and in the *_FILE env vars, are resolved against
+// $CREDENTIALS_DIRECTORY when systemd passes credentials (LoadCredential=).
+const (
+	fileRef = "file:"
+	envRef  = "env:"
+)
+
+// secrets returns the secret fields of config.yaml by key.
+func (f *configFile) secrets() []struct {
+	key   string
+	value *string
+} {
+	type secret = struct {
+		key   string
+		value *string
+	}
+	s := []secret{
+		{"posts.s3.access_key", &f.Posts.S3.AccessKey},
+		{"posts.s3.secret_key", &f.Posts.S3.SecretKey},
+		{"webhook.secret", &f.Webhook.Secret},
+		{"admin.token", &f.Admin.Token},
+		{"metrics.token", &f.Metrics.Token},
+	}
+	for i := range f.Sources {
+		p := fmt.Sprintf("sources[%d].", i)
+		s = append(s,
+			secret{p + "webhook_secret", &f.Sources[i].WebhookSecret},
+			secret{p + "s3.access_key", &f.Sources[i].S3.AccessKey},
+			secret{p + "s3.secret_key", &f.Sources[i].S3.SecretKey},
+		)
+	}
+	for i := range f.Notify.Webhooks {
+		s = append(s, secret{fmt.Sprintf("notify.webhooks[%d].secret", i), &f.Notify.Webhooks[i].Secret})
+	}
+	return s
+}
+
+// resolveSecrets replaces the file: and env: references among the secrets of config.yaml
+// with the secrets they point to.
+func (f *configFile) resolveSecrets() error {
+	var errs []error
+	for _, s := range f.secrets() {
+		v, err := resolveSecret(*s.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+			continue
+		}
+		*s.value = v
+	}
+	return errors.Join(errs...)
+}
+
+// resolveSecret returns the secret a file:<path> or env:<VAR> reference points to; other
+// values are the secret itself.
+func resolveSecret(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, fileRef):
+		return readSecretFile(strings.TrimPrefix(v, fileRef))
+	case strings.HasPrefix(v, envRef):
+		name := strings.TrimPrefix(v, envRef)
+		s := os.Getenv(name)
+		if s == "" {
+			return "", fmt.Errorf("env var %s is not set", name)
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// readSecretFile reads a secret from a file without its trailing newline. It warns when the
+// file is readable by everyone, since then any local user can read the secret.
+func readSecretFile(path string) (string, error) {
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file failed: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("secret file %s is not a regular file", path)
+	}
+	if fi.Mode().Perm()&0004 != 0 {
+		configLog.Warn("secret file is world-readable, run chmod o-r on it", "path", path, "mode", fmt.Sprintf("%04o", fi.Mode().Perm()))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file failed: %w", err)
+	}
+	s := strings.TrimRight(string(data), "\r\n")
+	if s == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return s, nil
+}
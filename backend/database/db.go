@@ -2,10 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
@@ -18,7 +17,7 @@ func New(dbPath string) (*DB, error) {
 		return nil, err
 	}
 
-	conn, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_synchronous=NORMAL")
+	conn, err := sql.Open(driverName, dbPath+"?_journal_mode=WAL&_synchronous=NORMAL")
 	if err != nil {
 		return nil, err
 	}
@@ -47,9 +46,139 @@ func (db *DB) initSchema() error {
 
 	CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_posts_slug ON posts(slug);
+
+	CREATE TABLE IF NOT EXISTS sync_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source TEXT NOT NULL DEFAULT 'default',
+		trigger TEXT NOT NULL,
+		status TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME,
+		commit_before TEXT NOT NULL DEFAULT '',
+		commit_after TEXT NOT NULL DEFAULT '',
+		added INTEGER NOT NULL DEFAULT 0,
+		updated INTEGER NOT NULL DEFAULT 0,
+		deleted INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		file_errors TEXT NOT NULL DEFAULT '[]'
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs(started_at DESC);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		delivery_id TEXT PRIMARY KEY,
+		event TEXT NOT NULL,
+		status TEXT NOT NULL,
+		received_at DATETIME NOT NULL
+	);
+
+	-- Events POSTed to outbound webhooks, with their retry state
+	CREATE TABLE IF NOT EXISTS outbound_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		event_id INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		next_attempt_at DATETIME,
+		delivered_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_outbound_deliveries_due ON outbound_deliveries(status, next_attempt_at);
+
+	-- One row per pinned content source: the commit its repo is held at
+	CREATE TABLE IF NOT EXISTS content_pins (
+		source TEXT PRIMARY KEY,
+		commit_sha TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '',
+		pinned_at DATETIME NOT NULL
+	);
+
+	-- ETags of the objects an S3 source mirrored, so a restart does not download the bucket again
+	CREATE TABLE IF NOT EXISTS content_etags (
+		source TEXT NOT NULL,
+		path TEXT NOT NULL,
+		etag TEXT NOT NULL,
+		PRIMARY KEY (source, path)
+	);
 	`
 
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema; existing databases are upgraded in place.
+	if err := db.addColumn("posts", "content_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// body keeps the last successfully parsed Markdown so a broken edit does not take the post down
+	if err := db.addColumn("posts", "body", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// parse_error is set while the file on disk fails to parse and body is stale
+	if err := db.addColumn("posts", "parse_error", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// First and last commits that touched the file; NULL / empty when the file is not in git history
+	for _, col := range []struct{ name, decl string }{
+		{"created_at", "DATETIME"},
+		{"created_by", "TEXT NOT NULL DEFAULT ''"},
+		{"last_modified_at", "DATETIME"},
+		{"last_modified_by", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := db.addColumn("posts", col.name, col.decl); err != nil {
+			return err
+		}
+	}
+
+	// Content source a post belongs to; posts from before multiple sources belong to the
+	// single source built from the posts settings ("default")
+	if err := db.addColumn("posts", "source", "TEXT NOT NULL DEFAULT 'default'"); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_posts_source ON posts(source)"); err != nil {
+		return err
+	}
+
+	// A run still marked running was interrupted by a crash or kill.
+	_, err := db.conn.Exec("UPDATE sync_runs SET status = 'aborted' WHERE status = 'running'")
+	return err
+}
+
+// addColumn adds a column unless it already exists (SQLite has no ADD COLUMN IF NOT EXISTS).
+func (db *DB) addColumn(table, column, decl string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
 	return err
 }
 
@@ -3,6 +3,8 @@ package database
 import (
 	"path/filepath"
 	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func TestNew(t *testing.T) {
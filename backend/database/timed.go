@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"blog-suiseiseki/metrics"
+)
+
+// driverName is sqlite3 with every statement timed in blog_db_query_duration_seconds.
+const driverName = "sqlite3_timed"
+
+var queryDuration = metrics.NewHistogram("blog_db_query_duration_seconds",
+	"Time spent executing SQLite statements, by operation (exec or query).",
+	[]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1}, "op")
+
+func init() {
+	sql.Register(driverName, timedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+type timedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d timedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// timedConn times Exec and Query; statements database/sql prepares itself are timed by
+// timedStmt. A query is timed until its first row is ready, not while the rows are read.
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observe("exec", time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observe("query", time.Now())
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{stmt.(*sqlite3.SQLiteStmt)}, nil
+}
+
+type timedStmt struct {
+	*sqlite3.SQLiteStmt
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observe("exec", time.Now())
+	return s.SQLiteStmt.ExecContext(ctx, args)
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observe("query", time.Now())
+	return s.SQLiteStmt.QueryContext(ctx, args)
+}
+
+func observe(op string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), op)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/models"
+	"blog-suiseiseki/services"
+)
+
+// AdminAuth guards /api/admin routes: requests must send "Authorization: Bearer <token>".
+// Without a configured token the admin API is open in dev and disabled in prod.
+func AdminAuth(token string, isDev bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			if isDev {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API disabled: no admin token configured"})
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminHandler serves the admin API. Endpoints act on the source named by ?source=,
+// defaulting to the primary source.
+type AdminHandler struct {
+	sources  *services.Sources
+	outbound *services.Outbound
+}
+
+func NewAdminHandler(sources *services.Sources) *AdminHandler {
+	return &AdminHandler{sources: sources}
+}
+
+// SetOutbound enables GET /api/admin/outbound-deliveries.
+func (h *AdminHandler) SetOutbound(o *services.Outbound) {
+	h.outbound = o
+}
+
+// GetDiagnostics returns per-file errors from the latest sync and the posts currently served
+// from a stale version; GET /api/admin/diagnostics.
+func (h *AdminHandler) GetDiagnostics(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	run, err := src.LatestRun(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	stale, err := src.StalePosts(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{
+		"source":      src.Source(),
+		"run_id":      nil,
+		"file_errors": []interface{}{},
+		"stale_posts": stale,
+	}
+	if run != nil {
+		resp["run_id"] = run.ID
+		resp["file_errors"] = run.FileErrors
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// TriggerSync runs a manual sync and returns the recorded run; POST /api/admin/sync.
+// Without ?source= every source is synced, and with several sources the response is
+// {"runs": [...]}, one latest run per source.
+func (h *AdminHandler) TriggerSync(c *gin.Context) {
+	ctx, cancel := syncContext(c)
+	defer cancel()
+	targets := h.sources.All()
+	if c.Query("source") != "" {
+		src := sourceParam(c, h.sources)
+		if src == nil {
+			return
+		}
+		targets = []*services.SyncService{src}
+	}
+
+	runs := make([]*models.SyncRun, 0, len(targets))
+	for _, src := range targets {
+		if err := src.Sync(ctx, services.TriggerManual); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "source " + src.Source() + ": " + err.Error()})
+			return
+		}
+		run, err := src.LatestRun(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 1 {
+		c.JSON(http.StatusOK, runs[0])
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+type pinRequest struct {
+	Commit string `json:"commit"`
+	Reason string `json:"reason"`
+}
+
+// GetPin returns the active pin, or null; GET /api/admin/pin.
+func (h *AdminHandler) GetPin(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	pin, err := src.CurrentPin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pin": pin})
+}
+
+// Pin holds the site at a commit (default: the one currently served) and resyncs; POST /api/admin/pin.
+func (h *AdminHandler) Pin(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	var req pinRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body: " + err.Error()})
+		return
+	}
+	pin, err := src.Pin(c.Request.Context(), req.Commit, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.syncAfterPin(c, src, pin)
+}
+
+// Unpin lets syncs follow the remote branch again and resyncs; DELETE /api/admin/pin.
+func (h *AdminHandler) Unpin(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	removed, err := src.Unpin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusOK, gin.H{"message": "not pinned"})
+		return
+	}
+	h.syncAfterPin(c, src, nil)
+}
+
+// GetRollbackTargets lists the recently synced commits the site can roll back to; GET /api/admin/rollback.
+func (h *AdminHandler) GetRollbackTargets(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	commits, err := src.SyncedCommits(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commits": commits})
+}
+
+// Rollback pins the site to one of the recently synced commits and resyncs; POST /api/admin/rollback.
+func (h *AdminHandler) Rollback(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	var req pinRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Commit == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be {\"commit\": \"<sha>\"}"})
+		return
+	}
+	pin, err := src.Rollback(c.Request.Context(), req.Commit, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.syncAfterPin(c, src, pin)
+}
+
+// syncAfterPin reindexes so a pin change is served immediately, then reports the pin and run.
+func (h *AdminHandler) syncAfterPin(c *gin.Context, src *services.SyncService, pin *models.Pin) {
+	ctx, cancel := syncContext(c)
+	defer cancel()
+	if err := src.Sync(ctx, services.TriggerPin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "pin": pin})
+		return
+	}
+	run, err := src.LatestRun(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pin": pin, "run": run})
+}
+
+// GetOutboundDeliveries returns the events POSTed to outbound webhooks, newest first;
+// GET /api/admin/outbound-deliveries.
+func (h *AdminHandler) GetOutboundDeliveries(c *gin.Context) {
+	if h.outbound == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no outbound webhooks configured"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	deliveries, err := h.outbound.ListDeliveries(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := h.outbound.CountDeliveries(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+	})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+type serverContextKey struct{}
+
+// WithServerContext marks ctx as the server-lifetime context; pass the result as the
+// http.Server BaseContext so syncs started by requests are cancelled on shutdown only.
+func WithServerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serverContextKey{}, ctx)
+}
+
+// syncContext returns a context for a sync started by a request. It keeps the request's
+// values (the request ID) but is not cancelled when the client disconnects: a provider that
+// gives up after its delivery timeout (GitHub: 10s) must not roll back a slow fetch halfway.
+// It is cancelled when the server context from WithServerContext is done.
+func syncContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	reqCtx := c.Request.Context()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(reqCtx))
+	server, ok := reqCtx.Value(serverContextKey{}).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(server, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
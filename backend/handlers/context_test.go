@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/logging"
+)
+
+func TestSyncContext(t *testing.T) {
+	server, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	reqCtx, disconnect := context.WithCancel(logging.WithRequestID(WithServerContext(server), "req-1"))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/webhook", nil).WithContext(reqCtx)
+	ctx, cancel := syncContext(c)
+	defer cancel()
+
+	disconnect()
+	if ctx.Err() != nil {
+		t.Fatal("want the sync context to outlive a disconnecting client")
+	}
+	if got := logging.RequestID(ctx); got != "req-1" {
+		t.Errorf("want the request ID kept, got %q", got)
+	}
+	shutdown()
+	<-ctx.Done() // cancelled by the server context
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+// DefaultHeartbeat is the interval of the keep-alive comments on an idle event stream, well
+// below the idle timeouts of common proxies.
+const DefaultHeartbeat = 15 * time.Second
+
+// EventsHandler streams the event bus as server-sent events.
+type EventsHandler struct {
+	bus       *services.EventBus
+	heartbeat time.Duration
+}
+
+func NewEventsHandler(bus *services.EventBus) *EventsHandler {
+	return &EventsHandler{bus: bus, heartbeat: DefaultHeartbeat}
+}
+
+// SetHeartbeat sets the keep-alive interval; d <= 0 restores the default.
+func (h *EventsHandler) SetHeartbeat(d time.Duration) {
+	if d <= 0 {
+		d = DefaultHeartbeat
+	}
+	h.heartbeat = d
+}
+
+// Stream handles GET /api/events. Each event carries its bus ID, so a reconnecting
+// EventSource sends Last-Event-ID and gets the events it missed replayed first. When they are
+// no longer buffered a "reset" event tells the client to refetch instead.
+func (h *EventsHandler) Stream(c *gin.Context) {
+	lastID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	if lastID == 0 {
+		lastID, _ = strconv.ParseUint(c.Query("last_event_id"), 10, 64)
+	}
+	sub := h.bus.Subscribe(lastID)
+	defer sub.Close()
+	sseSubscribers.Inc()
+	defer sseSubscribers.Dec()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	w := c.Writer
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Missed {
+		writeEvent(w, services.Event{ID: h.bus.LastID(), Type: "reset", Time: time.Now().UTC()})
+	}
+	for _, ev := range sub.Replay {
+		writeEvent(w, ev)
+	}
+	w.Flush()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Fell behind or shutting down: end the stream; the client reconnects and replays
+				return
+			}
+			writeEvent(w, ev)
+			w.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, ev services.Event) {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		data = []byte("null")
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+// streamEvents runs the event stream for d and returns what was written.
+func streamEvents(t *testing.T, h *EventsHandler, lastEventID string, d time.Duration) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/events", h.Stream)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/events", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestEventsStream(t *testing.T) {
+	bus := services.NewEventBus(2)
+	bus.Publish(services.EventPostCreated, services.PostEvent{Source: "default", Slug: "a", Path: "a.md"})
+	bus.Publish(services.EventPostUpdated, services.PostEvent{Source: "default", Slug: "b", Path: "b.md"})
+	bus.Publish(services.EventPostDeleted, services.PostEvent{Source: "default", Slug: "c", Path: "c.md"})
+	handler := NewEventsHandler(bus)
+	handler.SetHeartbeat(10 * time.Millisecond)
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:        "replays missed events",
+			lastEventID: "2",
+			want:        []string{"id: 3\nevent: post_deleted\ndata: {\"source\":\"default\",\"slug\":\"c\",\"title\":\"\",\"category\":\"\",\"path\":\"c.md\"}\n\n"},
+			notWant:     []string{"event: post_updated", "event: reset"},
+		},
+		{
+			name:        "resets after a restart",
+			lastEventID: "9",
+			want:        []string{"event: reset"},
+			notWant:     []string{"event: post_"},
+		},
+		{
+			name:    "new client gets no history",
+			want:    []string{"retry: 3000\n\n", ": heartbeat\n\n"},
+			notWant: []string{"event:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := streamEvents(t, handler, tt.lastEventID, 50*time.Millisecond)
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("want %q in stream, got %q", s, body)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("want no %q in stream, got %q", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestEventsStream_Live(t *testing.T) {
+	bus := services.NewEventBus(0)
+	bus.Publish(services.EventSyncCompleted, nil)
+	handler := NewEventsHandler(bus)
+
+	// Resuming from event 1, event 2 arrives whether it is published before or after subscribing
+	done := make(chan string)
+	go func() { done <- streamEvents(t, handler, "1", 100*time.Millisecond) }()
+	time.Sleep(20 * time.Millisecond)
+	bus.Publish(services.EventSyncFailed, map[string]string{"error": "boom"})
+
+	body := <-done
+	if !strings.Contains(body, "id: 2\nevent: sync_failed\ndata: {\"error\":\"boom\"}\n\n") {
+		t.Errorf("want live event in stream, got %q", body)
+	}
+	if strings.Contains(body, "id: 1\n") {
+		t.Errorf("want no replay of events the client has seen, got %q", body)
+	}
+}
+
+func TestEventsStream_BusClosed(t *testing.T) {
+	bus := services.NewEventBus(0)
+	handler := NewEventsHandler(bus)
+
+	// The stream must end when the bus closes, long before the request's own deadline
+	done := make(chan struct{})
+	go func() {
+		streamEvents(t, handler, "", 5*time.Second)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	bus.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want the stream to end when the bus is closed")
+	}
+}
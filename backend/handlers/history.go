@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+	"blog-suiseiseki/utils"
+)
+
+// HistoryHandler serves per-post revision history from the git repo of the post's source.
+type HistoryHandler struct {
+	db      *sql.DB
+	sources *services.Sources
+}
+
+func NewHistoryHandler(db *sql.DB, sources *services.Sources) *HistoryHandler {
+	return &HistoryHandler{db: db, sources: sources}
+}
+
+// GetHistory lists the commits that changed a post, newest first, at most ?limit= (default
+// 50, up to 100); GET /api/posts/:slug/history.
+func (h *HistoryHandler) GetHistory(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+	src, contentPath, ok := h.contentPath(c)
+	if !ok {
+		return
+	}
+	commits, err := src.FileHistory(c.Request.Context(), contentPath)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	total := len(commits)
+	if total > limit {
+		commits = commits[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"commits": commits, "total": total})
+}
+
+// GetDiff returns the change to a post's Markdown between two revisions, as a unified diff and
+// rendered HTML; GET /api/posts/:slug/diff?from=&to=. Defaults: from = first commit, to = latest.
+func (h *HistoryHandler) GetDiff(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	for _, rev := range []string{from, to} {
+		// Revisions go to git as arguments; one that looks like an option is never a commit
+		if strings.HasPrefix(rev, "-") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision " + strconv.Quote(rev)})
+			return
+		}
+	}
+	src, contentPath, ok := h.contentPath(c)
+	if !ok {
+		return
+	}
+	d, err := src.FileDiff(c.Request.Context(), contentPath, from, to)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	html := ""
+	if d.Diff != "" {
+		fence := codeFence(d.Diff)
+		html, err = utils.MarkdownToHTML(fence + "diff\n" + d.Diff + fence + "\n")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "markdown to HTML failed"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from": d.From,
+		"to":   d.To,
+		"diff": d.Diff,
+		"html": html,
+	})
+}
+
+// contentPath looks up the post's file and the source it was synced from.
+func (h *HistoryHandler) contentPath(c *gin.Context) (*services.SyncService, string, bool) {
+	var source, contentPath string
+	err := h.db.QueryRow("SELECT source, content_path FROM posts WHERE slug = ?", c.Param("slug")).Scan(&source, &contentPath)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return nil, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	src := h.sources.Get(source)
+	if src == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post source " + source + " is not configured"})
+		return nil, "", false
+	}
+	return src, contentPath, true
+}
+
+func (h *HistoryHandler) fail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoHistory):
+		c.JSON(http.StatusNotFound, gin.H{"error": "no revision history: " + err.Error()})
+	case errors.Is(err, services.ErrNoRevision):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "reading the revision history timed out"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// codeFence returns a backtick fence longer than any backtick run in s, so Markdown code
+// fences inside the diffed post cannot close the block early.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		longest = 2
+	}
+	return strings.Repeat("`", longest+1)
+}
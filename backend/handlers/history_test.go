@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+func TestPostHistoryWithoutGit(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	postsDir := t.TempDir()
+	insertTestPost(t, db, "plain", "Plain", postsDir+"/plain.md")
+	handler := NewHistoryHandler(db, services.NewSources(services.NewSyncService(db, postsDir, true, nil, "")))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/posts/:slug/history", handler.GetHistory)
+	router.GET("/api/posts/:slug/diff", handler.GetDiff)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/api/posts/missing/history", http.StatusNotFound},
+		{"/api/posts/plain/history", http.StatusNotFound},
+		{"/api/posts/plain/diff", http.StatusNotFound},
+		{"/api/posts/plain/history?limit=500", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: want status %d, got %d: %s", tt.path, tt.wantStatus, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPostDiffStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test repo")
+	}
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	postsDir := newPreviewRemote(t)
+	insertTestPost(t, db, "hello", "Hello", filepath.Join(postsDir, "hello.md"))
+	src := services.NewSyncService(db, postsDir, true, nil, "")
+	src.SetGitBackend(services.NewExecGitBackend()) // go-git does not stop at the timeout
+	handler := NewHistoryHandler(db, services.NewSources(src))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/posts/:slug/diff", handler.GetDiff)
+
+	tests := []struct {
+		path       string
+		timeout    time.Duration
+		wantStatus int
+	}{
+		{"/api/posts/hello/diff", time.Minute, http.StatusOK},
+		{"/api/posts/hello/diff?from=--output=x", time.Minute, http.StatusBadRequest},
+		{"/api/posts/hello/diff?from=0123abcd", time.Minute, http.StatusNotFound},
+		{"/api/posts/hello/diff", time.Nanosecond, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		src.SetGitTimeout(tt.timeout)
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s (git timeout %s): want status %d, got %d: %s", tt.path, tt.timeout, tt.wantStatus, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	if got := codeFence("+plain line\n"); got != "```" {
+		t.Errorf("want ```, got %s", got)
+	}
+	if got := codeFence("+```go\n+x\n+```\n"); got != "````" {
+		t.Errorf("want ````, got %s", got)
+	}
+}
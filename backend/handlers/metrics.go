@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("blog_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("blog_http_request_duration_seconds",
+		"HTTP request latency by method and route; streams count until they close.", metrics.DefBuckets, "method", "route")
+	sseSubscribers = metrics.NewGauge("blog_sse_subscribers", "Open /api/events streams.")
+	wsConnections  = metrics.NewGauge("blog_ws_connections", "Open /api/ws connections.")
+)
+
+// Metrics records the count and latency of every request by route pattern (e.g.
+// /api/posts/:slug), so slugs do not create a series each. Unrouted requests count as "unmatched".
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route)
+	}
+}
+
+// ServeMetrics handles GET /metrics in the Prometheus text format. With a token, scrapers
+// must send "Authorization: Bearer <token>".
+func ServeMetrics(token string) gin.HandlerFunc {
+	h := metrics.Handler()
+	return func(c *gin.Context) {
+		if token != "" {
+			got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/api/things/:slug", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/metrics", ServeMetrics("scrape-token"))
+
+	for _, path := range []string{"/api/things/a", "/api/things/b", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("want 401 without the token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200 with the token, got %d", w.Code)
+	}
+	for _, want := range []string{
+		// Slugs share the route's series
+		`blog_http_requests_total{method="GET",route="/api/things/:slug",status="204"} 2`,
+		`blog_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`blog_http_requests_total{method="GET",route="/metrics",status="401"} 1`,
+		`blog_http_request_duration_seconds_count{method="GET",route="/api/things/:slug"} 2`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, w.Body.String())
+		}
+	}
+}
@@ -12,31 +12,97 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"blog-suiseiseki/models"
+	"blog-suiseiseki/services"
 	"blog-suiseiseki/utils"
 )
 
+// renderCacheSize is how many rendered posts GetPost keeps.
+const renderCacheSize = 256
+
 // Match <img ... src="path" ...>
 var reImgSrc = regexp.MustCompile(`(?i)<img([^>]*)\s+src="([^"]+)"([^>]*)>`)
 
 type PostsHandler struct {
-	db        *sql.DB
-	postsPath string
+	db          *sql.DB
+	postsPath   string
+	assetPrefix string // URL prefix of ServePostAsset, used when rewriting img src
+	sourceLinks *services.SourceLinks
+	render      *utils.RenderCache
+
+	// Content sources other than the primary one (postsPath), by name
+	sources map[string]postSource
+}
+
+type postSource struct {
+	path        string
+	assetPrefix string
+	links       *services.SourceLinks
 }
 
 func NewPostsHandler(db *sql.DB, postsPath string) *PostsHandler {
 	return &PostsHandler{
-		db:        db,
-		postsPath: postsPath,
+		db:          db,
+		postsPath:   postsPath,
+		assetPrefix: "/api/posts-assets/",
+		render:      utils.NewRenderCache(renderCacheSize),
 	}
 }
 
+// SetAssetPrefix sets the URL prefix relative images are rewritten to (default /api/posts-assets/).
+func (h *PostsHandler) SetAssetPrefix(prefix string) {
+	h.assetPrefix = strings.TrimSuffix(prefix, "/") + "/"
+}
+
+// SetSourceLinks makes posts include source_url / history_url links to the hosting provider.
+func (h *PostsHandler) SetSourceLinks(links *services.SourceLinks) {
+	h.sourceLinks = links
+}
+
+// AddSource registers a content source besides the primary one. Its posts resolve images and
+// source links against postsPath, and its assets are served at /api/sources/<name>/posts-assets/.
+func (h *PostsHandler) AddSource(name, postsPath string, links *services.SourceLinks) {
+	if h.sources == nil {
+		h.sources = make(map[string]postSource)
+	}
+	h.sources[name] = postSource{
+		path:        postsPath,
+		assetPrefix: "/api/sources/" + name + "/posts-assets/",
+		links:       links,
+	}
+}
+
+// source returns the posts dir, asset prefix and links of the named source; unknown names
+// (including the primary source) resolve to the primary one.
+func (h *PostsHandler) source(name string) postSource {
+	if src, ok := h.sources[name]; ok {
+		return src
+	}
+	return postSource{path: h.postsPath, assetPrefix: h.assetPrefix, links: h.sourceLinks}
+}
+
+// setSourceLinks fills the post's links to its file on the hosting provider.
+func (h *PostsHandler) setSourceLinks(p *models.Post) {
+	src := h.source(p.Source)
+	if src.links == nil {
+		return
+	}
+	rel, err := filepath.Rel(src.path, p.ContentPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+	p.SourceURL = src.links.Source(rel)
+	p.HistoryURL = src.links.History(rel)
+}
+
 // GetPosts returns the list of posts.
 func (h *PostsHandler) GetPosts(c *gin.Context) {
 	limit := c.DefaultQuery("limit", "20")
 	offset := c.DefaultQuery("offset", "0")
 
 	query := `
-		SELECT id, slug, title, summary, category, published_at, content_path, updated_at
+		SELECT id, slug, source, title, summary, category, published_at, content_path, updated_at,
+			created_at, created_by, last_modified_at, last_modified_by
 		FROM posts
 		ORDER BY published_at DESC
 		LIMIT ? OFFSET ?
@@ -53,15 +119,21 @@ func (h *PostsHandler) GetPosts(c *gin.Context) {
 	for rows.Next() {
 		var p models.Post
 		var publishedAt, updatedAt string
+		var createdAt, lastModifiedAt sql.NullTime
 		err := rows.Scan(
 			&p.ID,
 			&p.Slug,
+			&p.Source,
 			&p.Title,
 			&p.Summary,
 			&p.Category,
 			&publishedAt,
 			&p.ContentPath,
 			&updatedAt,
+			&createdAt,
+			&p.CreatedBy,
+			&lastModifiedAt,
+			&p.LastModifiedBy,
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -70,6 +142,9 @@ func (h *PostsHandler) GetPosts(c *gin.Context) {
 
 		p.PublishedAt, _ = time.Parse("2006-01-02 15:04:05", publishedAt)
 		p.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+		p.CreatedAt = nullTime(createdAt)
+		p.LastModifiedAt = nullTime(lastModifiedAt)
+		h.setSourceLinks(&p)
 
 		posts = append(posts, p)
 	}
@@ -85,20 +160,28 @@ func (h *PostsHandler) GetPost(c *gin.Context) {
 	slug := c.Param("slug")
 
 	var p models.Post
-	var publishedAt, updatedAt string
+	var publishedAt, updatedAt, body string
+	var createdAt, lastModifiedAt sql.NullTime
 	err := h.db.QueryRow(`
-		SELECT id, slug, title, summary, category, published_at, content_path, updated_at
+		SELECT id, slug, source, title, summary, category, published_at, content_path, updated_at, body,
+			created_at, created_by, last_modified_at, last_modified_by
 		FROM posts
 		WHERE slug = ?
 	`, slug).Scan(
 		&p.ID,
 		&p.Slug,
+		&p.Source,
 		&p.Title,
 		&p.Summary,
 		&p.Category,
 		&publishedAt,
 		&p.ContentPath,
 		&updatedAt,
+		&body,
+		&createdAt,
+		&p.CreatedBy,
+		&lastModifiedAt,
+		&p.LastModifiedBy,
 	)
 
 	if err == sql.ErrNoRows {
@@ -112,22 +195,30 @@ func (h *PostsHandler) GetPost(c *gin.Context) {
 
 	p.PublishedAt, _ = time.Parse("2006-01-02 15:04:05", publishedAt)
 	p.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	p.CreatedAt = nullTime(createdAt)
+	p.LastModifiedAt = nullTime(lastModifiedAt)
+	h.setSourceLinks(&p)
 
-	_, markdownContent, err := utils.ParseMarkdownFile(p.ContentPath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read post content"})
-		return
+	// Prefer the body stored at sync time: it is the last version that parsed cleanly
+	markdownContent := body
+	if markdownContent == "" {
+		_, markdownContent, err = utils.ParseMarkdownFile(p.ContentPath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read post content"})
+			return
+		}
 	}
 
-	htmlContent, err := utils.MarkdownToHTML(markdownContent)
+	htmlContent, err := h.render.MarkdownToHTML(markdownContent)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "markdown to HTML failed"})
 		return
 	}
 
 	// Rewrite relative img src to /api/posts-assets/... so repo images display correctly
+	src := h.source(p.Source)
 	postDirRel := "."
-	if absPosts, err := filepath.Abs(h.postsPath); err == nil {
+	if absPosts, err := filepath.Abs(src.path); err == nil {
 		if postDirAbs, err := filepath.Abs(filepath.Dir(p.ContentPath)); err == nil {
 			if rel, err := filepath.Rel(absPosts, postDirAbs); err == nil {
 				postDirRel = filepath.ToSlash(rel)
@@ -137,7 +228,7 @@ func (h *PostsHandler) GetPost(c *gin.Context) {
 	if strings.Contains(postDirRel, "..") {
 		postDirRel = "."
 	}
-	htmlContent = rewriteRelativeImgSrc(htmlContent, postDirRel)
+	htmlContent = rewriteRelativeImgSrc(htmlContent, src.assetPrefix, postDirRel)
 
 	postWithContent := models.PostWithContent{
 		Post:    p,
@@ -147,8 +238,15 @@ func (h *PostsHandler) GetPost(c *gin.Context) {
 	c.JSON(http.StatusOK, postWithContent)
 }
 
-// rewriteRelativeImgSrc rewrites relative img src in HTML to /api/posts-assets/{postDirRel}/{src}.
-func rewriteRelativeImgSrc(html, postDirRel string) string {
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// rewriteRelativeImgSrc rewrites relative img src in HTML to {assetPrefix}{postDirRel}/{src}.
+func rewriteRelativeImgSrc(html, assetPrefix, postDirRel string) string {
 	postDirRel = path.Clean(postDirRel)
 	if strings.Contains(postDirRel, "..") {
 		postDirRel = "."
@@ -169,12 +267,23 @@ func rewriteRelativeImgSrc(html, postDirRel string) string {
 		if strings.HasPrefix(assetPath, "..") {
 			return match
 		}
-		return `<img` + prefix + ` src="/api/posts-assets/` + assetPath + `"` + suffix + `>`
+		return `<img` + prefix + ` src="` + assetPrefix + assetPath + `"` + suffix + `>`
 	})
 }
 
-// ServePostAsset serves static assets (e.g. images) from the posts repo; GET /api/posts-assets/*path.
+// ServePostAsset serves static assets (e.g. images) from the posts repo; GET /api/posts-assets/*path,
+// or GET /api/sources/:source/posts-assets/*path for a source added with AddSource.
 func (h *PostsHandler) ServePostAsset(c *gin.Context) {
+	postsPath := h.postsPath
+	if name := c.Param("source"); name != "" {
+		src, ok := h.sources[name]
+		if !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		postsPath = src.path
+	}
+
 	rawPath := strings.TrimPrefix(c.Param("path"), "/")
 	if rawPath == "" {
 		c.Status(http.StatusNotFound)
@@ -186,7 +295,7 @@ func (h *PostsHandler) ServePostAsset(c *gin.Context) {
 		c.Status(http.StatusNotFound)
 		return
 	}
-	absPosts, err := filepath.Abs(h.postsPath)
+	absPosts, err := filepath.Abs(postsPath)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
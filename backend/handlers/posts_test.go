@@ -13,6 +13,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"blog-suiseiseki/database"
+	"blog-suiseiseki/services"
 )
 
 func setupTestDB(t *testing.T) (*sql.DB, func()) {
@@ -89,6 +90,8 @@ func TestGetPost(t *testing.T) {
 	insertTestPost(t, db, slug, "Test Post", mdPath)
 
 	handler := NewPostsHandler(db, tmpDir)
+	links, _ := services.NewSourceLinks("https://github.com/org/posts.git", "main", "", "", "")
+	handler.SetSourceLinks(links)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -101,6 +104,14 @@ func TestGetPost(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
 	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if want := "https://github.com/org/posts/blob/main/test-post.md"; response["source_url"] != want {
+		t.Errorf("want source_url %s, got %v", want, response["source_url"])
+	}
 }
 
 func TestGetPostNotFound(t *testing.T) {
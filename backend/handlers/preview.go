@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+	"blog-suiseiseki/utils"
+)
+
+// PreviewHandler serves branch previews through the regular PostsHandler, one per preview DB.
+type PreviewHandler struct {
+	previews    *services.PreviewManager
+	sourceLinks *services.SourceLinks
+	// Shared by all previews: it is keyed by the Markdown, so previews of the same post share
+	// entries and removing a preview needs no cleanup
+	render *utils.RenderCache
+}
+
+func NewPreviewHandler(previews *services.PreviewManager) *PreviewHandler {
+	return &PreviewHandler{previews: previews, render: utils.NewRenderCache(renderCacheSize)}
+}
+
+// SetSourceLinks makes preview posts link to their file on the preview's branch.
+func (h *PreviewHandler) SetSourceLinks(links *services.SourceLinks) {
+	h.sourceLinks = links
+}
+
+type previewInfo struct {
+	Branch  string              `json:"branch"`
+	Key     string              `json:"key"`
+	URL     string              `json:"url"`
+	LastRun *services.PublicRun `json:"last_run"`
+}
+
+// ListPreviews returns the available branch previews; GET /api/previews.
+func (h *PreviewHandler) ListPreviews(c *gin.Context) {
+	list := []previewInfo{}
+	for _, p := range h.previews.List() {
+		run, err := p.Sync.LatestRun(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list = append(list, previewInfo{
+			Branch:  p.Branch,
+			Key:     p.Key,
+			URL:     "/preview/" + p.Key,
+			LastRun: services.RedactRun(run),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"previews": list})
+}
+
+// GetPosts: GET /api/preview/:branch/posts.
+func (h *PreviewHandler) GetPosts(c *gin.Context) {
+	h.serve(c, (*PostsHandler).GetPosts)
+}
+
+// GetPost: GET /api/preview/:branch/posts/:slug.
+func (h *PreviewHandler) GetPost(c *gin.Context) {
+	h.serve(c, (*PostsHandler).GetPost)
+}
+
+// ServePostAsset: GET /api/preview/:branch/posts-assets/*path.
+func (h *PreviewHandler) ServePostAsset(c *gin.Context) {
+	h.serve(c, (*PostsHandler).ServePostAsset)
+}
+
+// serve runs fn with a PostsHandler bound to the preview named by :branch (a preview key),
+// keeping the preview DB open until it returns, or writes 404.
+func (h *PreviewHandler) serve(c *gin.Context, fn func(*PostsHandler, *gin.Context)) {
+	p, release := h.previews.Acquire(c.Param("branch"))
+	defer release()
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "preview not found"})
+		return
+	}
+	fn(h.postsHandler(p), c)
+}
+
+// postsHandler returns a PostsHandler bound to preview p.
+func (h *PreviewHandler) postsHandler(p *services.Preview) *PostsHandler {
+	posts := NewPostsHandler(p.DB.Conn(), p.PostsPath)
+	posts.render = h.render
+	posts.SetAssetPrefix("/api/preview/" + p.Key + "/posts-assets/")
+	if h.sourceLinks != nil {
+		posts.SetSourceLinks(h.sourceLinks.ForBranch(p.Branch))
+	}
+	return posts
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+// newPreviewRemote creates a repo with main and a feature/draft branch that adds draft.md.
+func newPreviewRemote(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "hello.md"), []byte("---\ntitle: Hello\n---\n\nHello"), 0644)
+	git("add", "-A")
+	git("commit", "-m", "Add hello")
+	git("checkout", "-b", "feature/draft")
+	os.MkdirAll(filepath.Join(dir, "draft"), 0755)
+	os.WriteFile(filepath.Join(dir, "draft", "draft.md"), []byte("---\ntitle: Draft\nslug: draft\n---\n\n![img](pic.png)"), 0644)
+	git("add", "-A")
+	git("commit", "-m", "Add draft")
+	git("checkout", "main")
+	return dir
+}
+
+func TestPreviewFromWebhook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	remote := newPreviewRemote(t)
+	previewDir := filepath.Join(t.TempDir(), "previews")
+	previews := services.NewPreviewManager(previewDir, "file://"+remote, services.NewGoGitBackend(), time.Minute)
+	defer previews.Close()
+
+	syncService := services.NewSyncService(db, t.TempDir(), true, nil, "")
+	providers, _ := WebhookProviders([]string{ProviderGitHub})
+	webhook := NewWebhookHandler(syncService, services.NewDeliveryLog(db), providers, "", "main")
+	webhook.SetPreviews(previews)
+	preview := NewPreviewHandler(previews)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/webhook", webhook.HandleWebhook)
+	router.GET("/api/previews", preview.ListPreviews)
+	router.GET("/api/preview/:branch/posts", preview.GetPosts)
+	router.GET("/api/preview/:branch/posts/:slug", preview.GetPost)
+
+	push := func(delivery, body string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", "/api/webhook", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("push %s: want status 200, got %d: %s", delivery, w.Code, w.Body.String())
+		}
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	push("p1", `{"ref":"refs/heads/feature/draft","repository":{"default_branch":"main"}}`)
+
+	var runs int
+	db.QueryRow("SELECT COUNT(*) FROM sync_runs").Scan(&runs)
+	if runs != 0 {
+		t.Errorf("want main site not synced for a branch push, got %d runs", runs)
+	}
+
+	w := get("/api/preview/feature~draft/posts")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Posts []struct {
+			Slug string `json:"slug"`
+		} `json:"posts"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Posts) != 2 {
+		t.Errorf("want 2 posts in preview, got %+v", list.Posts)
+	}
+
+	w = get("/api/preview/feature~draft/posts/draft")
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`/api/preview/feature~draft/posts-assets/draft/pic.png`)) {
+		t.Errorf("want image rewritten to preview assets, got %s", w.Body.String())
+	}
+	p, release := previews.Acquire("feature~draft")
+	if posts := preview.postsHandler(p); posts.render != preview.render {
+		t.Error("want preview requests to share one render cache")
+	}
+	release()
+
+	w = get("/api/previews")
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"branch":"feature/draft"`)) {
+		t.Errorf("want preview listed, got %s", w.Body.String())
+	}
+
+	push("p2", `{"ref":"refs/heads/feature/draft","deleted":true,"repository":{"default_branch":"main"}}`)
+
+	if w := get("/api/preview/feature~draft/posts"); w.Code != http.StatusNotFound {
+		t.Errorf("want 404 after branch deletion, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(previewDir, "feature~draft")); !os.IsNotExist(err) {
+		t.Errorf("want preview dir removed, stat err: %v", err)
+	}
+}
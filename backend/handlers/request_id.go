@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/logging"
+)
+
+// RequestIDHeader carries the request ID in requests (set by a proxy) and responses.
+const RequestIDHeader = "X-Request-ID"
+
+var httpLog = logging.New("http")
+
+// RequestID gives every request an ID: the X-Request-ID a proxy sent when it is plausible,
+// otherwise a random one. The ID is echoed in the response and attached to the request
+// context, so handler and sync logs of the request carry it (e.g. a webhook delivery and the
+// sync run it triggered).
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// AccessLog logs each request at info level (warn for 5xx) under the http component; it
+// replaces gin's own logger so access logs share the output format.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client", c.ClientIP()),
+		}
+		if errs := c.Errors.String(); errs != "" {
+			attrs = append(attrs, slog.String("error", errs))
+		}
+		httpLog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts up to 128 printable ASCII characters, so a client cannot inject
+// line breaks or huge values into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
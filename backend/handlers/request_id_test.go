@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	var seen string
+	router.GET("/", func(c *gin.Context) {
+		seen = logging.RequestID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"from proxy", "edge-7f3a", true},
+		{"line break", "a\nb", false},
+		{"too long", strings.Repeat("x", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("response ID %q, context ID %q", got, seen)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("want incoming ID %q kept, got %q", tt.incoming, got)
+			}
+			if !tt.keep && len(got) != 16 {
+				t.Errorf("want a generated 16 character ID, got %q", got)
+			}
+		})
+	}
+}
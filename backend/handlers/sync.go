@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+// SyncHandler serves sync status and history. By default runs are redacted for the public
+// API; see SetDetailed.
+type SyncHandler struct {
+	sources  *services.Sources
+	detailed bool
+}
+
+func NewSyncHandler(sources *services.Sources) *SyncHandler {
+	return &SyncHandler{sources: sources}
+}
+
+// SetDetailed makes the handler return runs and pins as recorded, including error messages
+// (which can name remote URLs and filesystem paths), commits and file errors. Mount a
+// detailed handler behind AdminAuth only.
+func (h *SyncHandler) SetDetailed(detailed bool) {
+	h.detailed = detailed
+}
+
+// sourceParam returns the source named by the ?source= query parameter, defaulting to the
+// primary source. For an unknown name it responds 404 and returns nil.
+func sourceParam(c *gin.Context, sources *services.Sources) *services.SyncService {
+	name := c.Query("source")
+	if name == "" {
+		return sources.Primary()
+	}
+	src := sources.Get(name)
+	if src == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown source " + name})
+	}
+	return src
+}
+
+// GetStatus returns whether a sync is running, and for one source (?source=, default the
+// primary) the latest recorded run and the active pin (null when following the remote
+// branch); GET /api/sync/status. Redacted, pinned is only true or false.
+func (h *SyncHandler) GetStatus(c *gin.Context) {
+	src := sourceParam(c, h.sources)
+	if src == nil {
+		return
+	}
+	run, err := src.LatestRun(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pin, err := src.CurrentPin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{
+		"running":  h.sources.Running(),
+		"source":   src.Source(),
+		"sources":  h.sources.Names(),
+		"last_run": run,
+		"pinned":   pin,
+	}
+	if !h.detailed {
+		resp["last_run"] = services.RedactRun(run)
+		resp["pinned"] = pin != nil
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetHistory returns recorded sync runs of all sources, newest first; GET /api/sync/history.
+func (h *SyncHandler) GetHistory(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	runs, err := h.sources.Primary().ListRuns(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := h.sources.Primary().CountRuns(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.detailed {
+		public := make([]*services.PublicRun, len(runs))
+		for i := range runs {
+			public[i] = services.RedactRun(&runs[i])
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": public, "total": total})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  runs,
+		"total": total,
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+func TestGetSyncHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	syncService := services.NewSyncService(db, t.TempDir(), true, nil, "")
+	if err := syncService.Sync(context.Background(), services.TriggerManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	handler := NewSyncHandler(services.NewSources(syncService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/sync/status", handler.GetStatus)
+	router.GET("/api/sync/history", handler.GetHistory)
+
+	req, _ := http.NewRequest("GET", "/api/sync/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Runs  []map[string]interface{} `json:"runs"`
+		Total int                      `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if response.Total != 1 || len(response.Runs) != 1 {
+		t.Fatalf("want 1 run, got total=%d len=%d", response.Total, len(response.Runs))
+	}
+	if response.Runs[0]["trigger"] != services.TriggerManual {
+		t.Errorf("want trigger manual, got %v", response.Runs[0]["trigger"])
+	}
+
+	req, _ = http.NewRequest("GET", "/api/sync/status", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status 200, got %d", w.Code)
+	}
+}
+
+func TestSyncStatus_Redacted(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Cloning a missing remote fails; errors like this can name the remote and paths
+	remote := filepath.Join(t.TempDir(), "missing")
+	syncService := services.NewSyncService(db, filepath.Join(t.TempDir(), "posts"), true, nil, "file://"+remote)
+	if err := syncService.Sync(context.Background(), services.TriggerManual); err == nil {
+		t.Fatal("want the sync to fail")
+	}
+	sources := services.NewSources(syncService)
+	public := NewSyncHandler(sources)
+	detailed := NewSyncHandler(sources)
+	detailed.SetDetailed(true)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/sync/status", public.GetStatus)
+	router.GET("/api/sync/history", public.GetHistory)
+	router.GET("/api/admin/sync/status", detailed.GetStatus)
+	router.GET("/api/admin/sync/history", detailed.GetHistory)
+
+	for _, path := range []string{"/api/sync/status", "/api/sync/history"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: want 200, got %d", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "git clone failed") || strings.Contains(w.Body.String(), `"error"`) {
+			t.Errorf("%s: error not redacted: %s", path, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"status":"failed"`) {
+			t.Errorf("%s: want the failed status, got %s", path, w.Body.String())
+		}
+	}
+	for _, path := range []string{"/api/admin/sync/status", "/api/admin/sync/history"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(w.Body.String(), "git clone failed") {
+			t.Errorf("%s: want the full error, got %s", path, w.Body.String())
+		}
+	}
+}
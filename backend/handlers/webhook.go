@@ -1,65 +1,201 @@
 package handlers
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"blog-suiseiseki/logging"
 	"blog-suiseiseki/services"
 )
 
+var webhookLog = logging.New("webhook")
+
 type WebhookHandler struct {
 	syncService *services.SyncService
-	secret      string
+	deliveries  *services.DeliveryLog
+	providers   []WebhookProvider
+	secret      func() string
+	branch      string // branch whose pushes trigger a sync; empty = repository default branch
+	previews    *services.PreviewManager
 }
 
-func NewWebhookHandler(syncService *services.SyncService, secret string) *WebhookHandler {
+func NewWebhookHandler(syncService *services.SyncService, deliveries *services.DeliveryLog, providers []WebhookProvider, secret, branch string) *WebhookHandler {
 	return &WebhookHandler{
 		syncService: syncService,
-		secret:      secret,
+		deliveries:  deliveries,
+		providers:   providers,
+		secret:      func() string { return secret },
+		branch:      branch,
 	}
 }
 
-// HandleWebhook handles GitHub Webhook requests.
+// SetSecretFunc makes the handler read its secret from fn on every request, e.g. from the
+// live config a reload swaps in; it replaces the secret passed to NewWebhookHandler.
+func (h *WebhookHandler) SetSecretFunc(fn func() string) {
+	h.secret = fn
+}
+
+// SetPreviews enables branch previews: pushes to other branches update their preview and
+// branch deletions drop it.
+func (h *WebhookHandler) SetPreviews(previews *services.PreviewManager) {
+	h.previews = previews
+}
+
+// HandleWebhook handles push webhooks from the configured providers (GitHub, GitLab, Gitea/Forgejo, Bitbucket).
+// ping is answered without syncing, only pushes to the configured branch sync the site (other
+// branches update their preview when previews are enabled), and deliveries already seen are
+// acknowledged but not re-run.
 func (h *WebhookHandler) HandleWebhook(c *gin.Context) {
+	provider := h.detectProvider(c.Request)
+	if provider == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unrecognized webhook: no event header from an enabled provider"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
 	// Verify signature if secret is configured
-	if h.secret != "" {
-		signature := c.GetHeader("X-Hub-Signature-256")
-		if signature == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing signature"})
+	if secret := h.secret(); secret != "" {
+		if err := provider.Verify(c.Request, body, secret); err != nil {
+			webhookLog.WarnContext(c.Request.Context(), "signature rejected", "provider", provider.Name(), "error", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
+	}
 
-		body, err := io.ReadAll(c.Request.Body)
+	event, err := provider.Parse(c.Request, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+
+	switch event.Kind {
+	case eventPing:
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		return
+	case eventPush:
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": "ignored event: " + event.Kind})
+		return
+	}
+
+	branch := h.branch
+	if branch == "" {
+		branch = event.DefaultBranch
+	}
+	if branch == "" {
+		// Bitbucket does not send the default branch: use the one the posts dir serves
+		b, err := h.syncService.DefaultBranch(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
-			return
+			webhookLog.WarnContext(c.Request.Context(), "read default branch failed", "error", err)
 		}
+		branch = b
+	}
+	if branch == "" {
+		c.JSON(http.StatusAccepted, gin.H{"message": "ignored push: no branch configured and no default branch known"})
+		return
+	}
+	mainPush := pushesBranch(event, branch)
+	previewRefs := h.previewRefs(event, branch)
+	if !mainPush && len(previewRefs) == 0 {
+		c.JSON(http.StatusAccepted, gin.H{"message": "ignored push: branch " + branch + " not updated"})
+		return
+	}
 
-		if !h.verifySignature(body, signature) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "signature verification failed"})
+	ctx, cancel := syncContext(c)
+	defer cancel()
+	var deliveryID string
+	if event.DeliveryID != "" {
+		deliveryID = provider.Name() + ":" + event.DeliveryID
+		fresh, err := h.deliveries.Begin(ctx, deliveryID, event.Kind)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !fresh {
+			c.JSON(http.StatusOK, gin.H{"message": "duplicate delivery, already processed"})
 			return
 		}
+	}
 
-		c.Request.Body = io.NopCloser(io.Reader(bytes.NewReader(body)))
+	webhookLog.InfoContext(ctx, "push received", "provider", provider.Name(), "delivery", deliveryID, "branch", branch, "sync", mainPush, "previews", len(previewRefs))
+	var syncErr error
+	if mainPush {
+		syncErr = h.syncService.Sync(ctx, services.TriggerWebhook)
+	}
+	for _, ref := range previewRefs {
+		if err := h.updatePreview(ctx, ref); err != nil {
+			webhookLog.ErrorContext(ctx, "update preview failed", "branch", ref.Branch, "error", err)
+			if syncErr == nil {
+				syncErr = err
+			}
+		}
 	}
 
-	if err := h.syncService.Sync(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if deliveryID != "" {
+		status := services.DeliveryDone
+		if syncErr != nil {
+			status = services.DeliveryFailed
+		}
+		if err := h.deliveries.Finish(deliveryID, status); err != nil {
+			webhookLog.ErrorContext(ctx, "record delivery failed", "delivery", deliveryID, "error", err)
+		}
+	}
+
+	if syncErr != nil {
+		// The error can name remote URLs and paths; the sender only needs to know it failed
+		webhookLog.ErrorContext(ctx, "delivery failed", "delivery", deliveryID, "error", syncErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "sync failed, see the server log"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "sync ok"})
 }
 
-func (h *WebhookHandler) verifySignature(body []byte, signature string) bool {
-	mac := hmac.New(sha256.New, []byte(h.secret))
-	mac.Write(body)
-	expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+// previewRefs returns the pushed refs other than branch when previews are enabled.
+func (h *WebhookHandler) previewRefs(event *webhookEvent, branch string) []refChange {
+	if h.previews == nil {
+		return nil
+	}
+	var refs []refChange
+	for _, ref := range event.Refs {
+		if ref.Branch != branch {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+func (h *WebhookHandler) updatePreview(ctx context.Context, ref refChange) error {
+	if ref.Deleted {
+		return h.previews.Remove(ref.Branch)
+	}
+	_, err := h.previews.Update(ctx, ref.Branch)
+	return err
+}
+
+func (h *WebhookHandler) detectProvider(r *http.Request) WebhookProvider {
+	for _, p := range h.providers {
+		if p.Detect(r) {
+			return p
+		}
+	}
+	return nil
+}
+
+// pushesBranch reports whether the push updated (not deleted) branch.
+func pushesBranch(event *webhookEvent, branch string) bool {
+	for _, ref := range event.Refs {
+		if ref.Branch == branch && !ref.Deleted {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Supported webhook providers (config webhook.providers).
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderForgejo   = "forgejo"
+	ProviderBitbucket = "bitbucket"
+)
+
+// Normalized event kinds; anything else is reported with the provider's own event name.
+const (
+	eventPing = "ping"
+	eventPush = "push"
+)
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errBadSignature     = errors.New("signature verification failed")
+)
+
+// zeroSHA marks a deleted ref in GitLab and Gitea push payloads.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// webhookEvent is a provider-independent view of an incoming webhook.
+type webhookEvent struct {
+	Kind          string
+	DeliveryID    string
+	DefaultBranch string // empty when the provider does not send it
+	Refs          []refChange
+}
+
+type refChange struct {
+	Branch  string
+	Deleted bool
+}
+
+// WebhookProvider recognizes, authenticates and parses one hosting provider's webhooks.
+type WebhookProvider interface {
+	Name() string
+	// Detect reports whether the request carries this provider's event header.
+	Detect(r *http.Request) bool
+	Verify(r *http.Request, body []byte, secret string) error
+	Parse(r *http.Request, body []byte) (*webhookEvent, error)
+}
+
+// WebhookProviders returns the providers for the given names; unknown names are an error.
+func WebhookProviders(names []string) ([]WebhookProvider, error) {
+	var providers []WebhookProvider
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case ProviderGitHub:
+			providers = append(providers, githubProvider{})
+		case ProviderGitLab:
+			providers = append(providers, gitlabProvider{})
+		case ProviderGitea, ProviderForgejo:
+			providers = append(providers, giteaProvider{})
+		case ProviderBitbucket:
+			providers = append(providers, bitbucketProvider{})
+		default:
+			return nil, fmt.Errorf("unknown webhook provider %q", name)
+		}
+	}
+	return providers, nil
+}
+
+// hmacSHA256Hex returns the hex HMAC-SHA256 of body.
+func hmacSHA256Hex(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyHMAC(signature, expected string) error {
+	if signature == "" {
+		return errMissingSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// refBranch strips refs/heads/ from a ref; tags and other refs return "".
+func refBranch(ref string) string {
+	if b, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		return b
+	}
+	return ""
+}
+
+// githubProvider: X-GitHub-Event, X-GitHub-Delivery, X-Hub-Signature-256.
+type githubProvider struct{}
+
+func (githubProvider) Name() string { return ProviderGitHub }
+
+// Detect ignores Gitea/Forgejo/Gogs, which also send X-GitHub-Event for compatibility.
+func (githubProvider) Detect(r *http.Request) bool {
+	return r.Header.Get("X-GitHub-Event") != "" &&
+		firstHeader(r, "X-Gitea-Event", "X-Forgejo-Event", "X-Gogs-Event") == ""
+}
+
+func (githubProvider) Verify(r *http.Request, body []byte, secret string) error {
+	return verifyHMAC(r.Header.Get("X-Hub-Signature-256"), "sha256="+hmacSHA256Hex(secret, body))
+}
+
+func (githubProvider) Parse(r *http.Request, body []byte) (*webhookEvent, error) {
+	ev := &webhookEvent{
+		Kind:       r.Header.Get("X-GitHub-Event"),
+		DeliveryID: r.Header.Get("X-GitHub-Delivery"),
+	}
+	if ev.Kind != eventPush {
+		return ev, nil
+	}
+
+	// GitHub may send the payload form-encoded in a "payload" field
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(form.Get("payload"))
+	}
+	var p struct {
+		Ref        string `json:"ref"`
+		Deleted    bool   `json:"deleted"`
+		Repository struct {
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	ev.DefaultBranch = p.Repository.DefaultBranch
+	if b := refBranch(p.Ref); b != "" {
+		ev.Refs = []refChange{{Branch: b, Deleted: p.Deleted}}
+	}
+	return ev, nil
+}
+
+// gitlabProvider: X-Gitlab-Event, X-Gitlab-Event-UUID, X-Gitlab-Token (shared secret, not an HMAC).
+type gitlabProvider struct{}
+
+func (gitlabProvider) Name() string { return ProviderGitLab }
+
+func (gitlabProvider) Detect(r *http.Request) bool { return r.Header.Get("X-Gitlab-Event") != "" }
+
+func (gitlabProvider) Verify(r *http.Request, body []byte, secret string) error {
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" {
+		return errMissingSignature
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return errBadSignature
+	}
+	return nil
+}
+
+func (gitlabProvider) Parse(r *http.Request, body []byte) (*webhookEvent, error) {
+	ev := &webhookEvent{
+		Kind:       r.Header.Get("X-Gitlab-Event"),
+		DeliveryID: r.Header.Get("X-Gitlab-Event-UUID"),
+	}
+	if ev.Kind != "Push Hook" {
+		return ev, nil
+	}
+	ev.Kind = eventPush
+
+	var p struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Project struct {
+			DefaultBranch string `json:"default_branch"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	ev.DefaultBranch = p.Project.DefaultBranch
+	if b := refBranch(p.Ref); b != "" {
+		ev.Refs = []refChange{{Branch: b, Deleted: p.After == zeroSHA}}
+	}
+	return ev, nil
+}
+
+// giteaProvider covers Gitea and Forgejo: X-Gitea-Event, X-Gitea-Delivery and X-Gitea-Signature
+// (hex HMAC-SHA256 without prefix). Forgejo sends X-Forgejo-* alongside the Gitea headers.
+type giteaProvider struct{}
+
+func (giteaProvider) Name() string { return ProviderGitea }
+
+func (giteaProvider) Detect(r *http.Request) bool {
+	return r.Header.Get("X-Gitea-Event") != "" || r.Header.Get("X-Forgejo-Event") != ""
+}
+
+func (giteaProvider) Verify(r *http.Request, body []byte, secret string) error {
+	signature := r.Header.Get("X-Gitea-Signature")
+	if signature == "" {
+		signature = r.Header.Get("X-Forgejo-Signature")
+	}
+	return verifyHMAC(signature, hmacSHA256Hex(secret, body))
+}
+
+func (giteaProvider) Parse(r *http.Request, body []byte) (*webhookEvent, error) {
+	ev := &webhookEvent{
+		Kind:       firstHeader(r, "X-Gitea-Event", "X-Forgejo-Event"),
+		DeliveryID: firstHeader(r, "X-Gitea-Delivery", "X-Forgejo-Delivery"),
+	}
+	if ev.Kind != eventPush {
+		return ev, nil
+	}
+
+	var p struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Repository struct {
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	ev.DefaultBranch = p.Repository.DefaultBranch
+	if b := refBranch(p.Ref); b != "" {
+		ev.Refs = []refChange{{Branch: b, Deleted: p.After == zeroSHA}}
+	}
+	return ev, nil
+}
+
+// bitbucketProvider covers Bitbucket Cloud (repo:push) and Bitbucket Server/Data Center
+// (repo:refs_changed, diagnostics:ping); both sign with X-Hub-Signature "sha256=<hex>".
+type bitbucketProvider struct{}
+
+func (bitbucketProvider) Name() string { return ProviderBitbucket }
+
+func (bitbucketProvider) Detect(r *http.Request) bool { return r.Header.Get("X-Event-Key") != "" }
+
+func (bitbucketProvider) Verify(r *http.Request, body []byte, secret string) error {
+	return verifyHMAC(r.Header.Get("X-Hub-Signature"), "sha256="+hmacSHA256Hex(secret, body))
+}
+
+func (bitbucketProvider) Parse(r *http.Request, body []byte) (*webhookEvent, error) {
+	ev := &webhookEvent{
+		Kind:       r.Header.Get("X-Event-Key"),
+		DeliveryID: firstHeader(r, "X-Request-UUID", "X-Request-Id"),
+	}
+	switch ev.Kind {
+	case "diagnostics:ping":
+		ev.Kind = eventPing
+		return ev, nil
+	case "repo:push":
+		var p struct {
+			Push struct {
+				Changes []struct {
+					New *struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"new"`
+					Old *struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"old"`
+				} `json:"changes"`
+			} `json:"push"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		ev.Kind = eventPush
+		for _, ch := range p.Push.Changes {
+			switch {
+			case ch.New != nil && ch.New.Type == "branch":
+				ev.Refs = append(ev.Refs, refChange{Branch: ch.New.Name})
+			case ch.New == nil && ch.Old != nil && ch.Old.Type == "branch":
+				ev.Refs = append(ev.Refs, refChange{Branch: ch.Old.Name, Deleted: true})
+			}
+		}
+	case "repo:refs_changed":
+		var p struct {
+			Changes []struct {
+				Ref struct {
+					ID   string `json:"id"`
+					Type string `json:"type"`
+				} `json:"ref"`
+				Type string `json:"type"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		ev.Kind = eventPush
+		for _, ch := range p.Changes {
+			if b := refBranch(ch.Ref.ID); b != "" {
+				ev.Refs = append(ev.Refs, refChange{Branch: b, Deleted: ch.Type == "DELETE"})
+			}
+		}
+	}
+	return ev, nil
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
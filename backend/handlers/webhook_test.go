@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"blog-suiseiseki/services"
+)
+
+const testPushPayload = `{"ref":"refs/heads/main","deleted":false,"repository":{"default_branch":"main"}}`
+
+func signBody(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleWebhook(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	const secret = "test-secret"
+	syncService := services.NewSyncService(db, t.TempDir(), true, nil, "")
+	providers, _ := WebhookProviders([]string{ProviderGitHub})
+	handler := NewWebhookHandler(syncService, services.NewDeliveryLog(db), providers, secret, "")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/webhook", handler.HandleWebhook)
+
+	tests := []struct {
+		name       string
+		event      string
+		delivery   string
+		body       string
+		signature  string
+		wantStatus int
+		wantRuns   int
+	}{
+		{"bad signature", "push", "d1", testPushPayload, "sha256=00", http.StatusUnauthorized, 0},
+		{"ping", "ping", "d2", `{"zen":"hi"}`, "", http.StatusOK, 0},
+		{"other event", "issues", "d3", `{}`, "", http.StatusAccepted, 0},
+		{"other branch", "push", "d4", `{"ref":"refs/heads/draft","repository":{"default_branch":"main"}}`, "", http.StatusAccepted, 0},
+		{"push to default branch", "push", "d5", testPushPayload, "", http.StatusOK, 1},
+		{"redelivery", "push", "d5", testPushPayload, "", http.StatusOK, 1},
+		{"new delivery", "push", "d6", testPushPayload, "", http.StatusOK, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/webhook", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-GitHub-Delivery", tt.delivery)
+			signature := tt.signature
+			if signature == "" {
+				signature = signBody(secret, tt.body)
+			}
+			req.Header.Set("X-Hub-Signature-256", signature)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var runs int
+			if err := db.QueryRow("SELECT COUNT(*) FROM sync_runs").Scan(&runs); err != nil {
+				t.Fatalf("count runs: %v", err)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("want %d sync runs, got %d", tt.wantRuns, runs)
+			}
+		})
+	}
+
+	// A secret rotated on config reload applies to the next request
+	handler.SetSecretFunc(func() string { return "rotated" })
+	for _, tt := range []struct {
+		secret     string
+		wantStatus int
+	}{{secret, http.StatusUnauthorized}, {"rotated", http.StatusOK}} {
+		body := `{"zen":"hi"}`
+		req, _ := http.NewRequest("POST", "/api/webhook", bytes.NewBufferString(body))
+		req.Header.Set("X-GitHub-Event", "ping")
+		req.Header.Set("X-Hub-Signature-256", signBody(tt.secret, body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("signed with %q: want status %d, got %d", tt.secret, tt.wantStatus, w.Code)
+		}
+	}
+}
+
+func loadFixture(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join("testdata", "webhooks", name))
+	if err != nil {
+		t.Fatalf("read fixture %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestHandleWebhookProviders(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	const secret = "test-secret"
+	syncService := services.NewSyncService(db, t.TempDir(), true, nil, "")
+	providers, err := WebhookProviders([]string{ProviderGitHub, ProviderGitLab, ProviderGitea, ProviderBitbucket})
+	if err != nil {
+		t.Fatalf("providers: %v", err)
+	}
+	handler := NewWebhookHandler(syncService, services.NewDeliveryLog(db), providers, secret, "main")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/webhook", handler.HandleWebhook)
+
+	hexMAC := func(body string) string { return signBody(secret, body)[len("sha256="):] }
+
+	tests := []struct {
+		name       string
+		fixture    string
+		headers    func(body string) map[string]string
+		wantStatus int
+		wantSync   bool
+	}{
+		{
+			name:    "github ping",
+			fixture: "github_ping.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-GitHub-Event": "ping", "X-GitHub-Delivery": "gh-1", "X-Hub-Signature-256": signBody(secret, body)}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "github push to other branch",
+			fixture: "github_push_branch.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "gh-2", "X-Hub-Signature-256": signBody(secret, body)}
+			},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:    "github push",
+			fixture: "github_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "gh-3", "X-Hub-Signature-256": signBody(secret, body)}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "gitlab bad token",
+			fixture: "gitlab_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Event-UUID": "gl-1", "X-Gitlab-Token": "wrong"}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "gitlab push",
+			fixture: "gitlab_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Event-UUID": "gl-2", "X-Gitlab-Token": secret}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "gitea push",
+			fixture: "gitea_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{
+					"X-GitHub-Event":    "push",
+					"X-Gitea-Event":     "push",
+					"X-Gitea-Delivery":  "gt-1",
+					"X-Gitea-Signature": hexMAC(body),
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "gitea redelivery",
+			fixture: "gitea_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Gitea-Event": "push", "X-Gitea-Delivery": "gt-1", "X-Gitea-Signature": hexMAC(body)}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "forgejo push",
+			fixture: "gitea_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Forgejo-Event": "push", "X-Forgejo-Delivery": "fj-1", "X-Forgejo-Signature": hexMAC(body)}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "bitbucket cloud push",
+			fixture: "bitbucket_cloud_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Event-Key": "repo:push", "X-Request-UUID": "bb-1", "X-Hub-Signature": signBody(secret, body)}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "bitbucket server push",
+			fixture: "bitbucket_server_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Event-Key": "repo:refs_changed", "X-Request-Id": "bbs-1", "X-Hub-Signature": signBody(secret, body)}
+			},
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:    "bitbucket bad signature",
+			fixture: "bitbucket_cloud_push.json",
+			headers: func(body string) map[string]string {
+				return map[string]string{"X-Event-Key": "repo:push", "X-Request-UUID": "bb-2", "X-Hub-Signature": "sha256=00"}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before int
+			db.QueryRow("SELECT COUNT(*) FROM sync_runs").Scan(&before)
+
+			body := loadFixture(t, tt.fixture)
+			req, _ := http.NewRequest("POST", "/api/webhook", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers(body) {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var after int
+			db.QueryRow("SELECT COUNT(*) FROM sync_runs").Scan(&after)
+			if synced := after > before; synced != tt.wantSync {
+				t.Errorf("want sync %v, got %v", tt.wantSync, synced)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookBitbucketDefaultBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// The clone records origin/HEAD (main); the Bitbucket payload has no default branch
+	syncService := services.NewSyncService(db, filepath.Join(t.TempDir(), "posts"), false, nil, "file://"+newPreviewRemote(t))
+	if err := syncService.Sync(context.Background(), services.TriggerStartup); err != nil {
+		t.Fatalf("initial sync: %v", err)
+	}
+	providers, _ := WebhookProviders([]string{ProviderBitbucket})
+	handler := NewWebhookHandler(syncService, services.NewDeliveryLog(db), providers, "", "")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/webhook", handler.HandleWebhook)
+
+	req, _ := http.NewRequest("POST", "/api/webhook", bytes.NewBufferString(loadFixture(t, "bitbucket_cloud_push.json")))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Key", "repo:push")
+	req.Header.Set("X-Request-UUID", "bb-default")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want the push to main synced, got %d: %s", w.Code, w.Body.String())
+	}
+	var runs int
+	db.QueryRow("SELECT COUNT(*) FROM sync_runs WHERE trigger = ?", services.TriggerWebhook).Scan(&runs)
+	if runs != 1 {
+		t.Errorf("want 1 webhook sync, got %d", runs)
+	}
+}
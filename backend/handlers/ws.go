@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"blog-suiseiseki/services"
+)
+
+const (
+	// DefaultWSPingInterval is how often the server pings an idle connection.
+	DefaultWSPingInterval = 30 * time.Second
+	// wsWriteWait bounds one write; a client that cannot take a frame in time is dropped.
+	wsWriteWait = 10 * time.Second
+	// wsMaxMessage bounds client messages, which are only subscription requests.
+	wsMaxMessage = 4096
+	// wsRequestBuffer is how many client requests may wait for the writer.
+	wsRequestBuffer = 8
+)
+
+// wsMessage is a client request, or a server reply that is not an event.
+type wsMessage struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// WSHandler serves the event bus over WebSocket, for clients whose proxies break SSE.
+// Unlike /api/events a client picks the topics it receives, see services.Event.Topics.
+type WSHandler struct {
+	bus          *services.EventBus
+	upgrader     websocket.Upgrader
+	pingInterval time.Duration
+}
+
+// NewWSHandler accepts same-origin browsers, clients sending no Origin (e.g. a desktop app)
+// and the given origins ("*" for any), e.g. sites embedding a widget.
+func NewWSHandler(bus *services.EventBus, allowedOrigins []string) *WSHandler {
+	return &WSHandler{
+		bus:          bus,
+		pingInterval: DefaultWSPingInterval,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return originAllowed(r, allowedOrigins) },
+		},
+	}
+}
+
+// SetPingInterval sets the keepalive interval; a client missing two pongs is dropped.
+// d <= 0 restores the default.
+func (h *WSHandler) SetPingInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultWSPingInterval
+	}
+	h.pingInterval = d
+}
+
+// Serve handles GET /api/ws?topics=slug:hello,sync&last_event_id=12. Without topics the client
+// receives every event; it can change them with {"type": "subscribe" | "unsubscribe",
+// "topics": [...]} messages. Events are sent as {"id", "type", "time", "data"} like on
+// /api/events; a client that falls behind is disconnected with close code 1013 and can
+// reconnect with last_event_id to replay what it missed.
+func (h *WSHandler) Serve(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // the upgrader has replied
+	}
+	defer conn.Close()
+	wsConnections.Inc()
+	defer wsConnections.Dec()
+
+	topics := map[string]bool{"all": true}
+	if v := c.Query("topics"); v != "" {
+		topics = map[string]bool{}
+		addTopics(topics, strings.Split(v, ","))
+	}
+	lastID, _ := strconv.ParseUint(c.Query("last_event_id"), 10, 64)
+	sub := h.bus.Subscribe(lastID)
+	defer sub.Close()
+
+	pongWait := 2 * h.pingInterval
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// The reader only forwards requests: all writes happen below, in one goroutine
+	requests := make(chan wsMessage, wsRequestBuffer)
+	closed := make(chan struct{})
+	flooded := false // set by the reader before closing closed
+	go func() {
+		defer close(closed)
+		for {
+			_, r, err := conn.NextReader()
+			if err != nil {
+				return // closed by the client, or no pong in time
+			}
+			var msg wsMessage
+			if err := json.NewDecoder(r).Decode(&msg); err != nil {
+				msg = wsMessage{Type: "invalid"}
+			}
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+			select {
+			case requests <- msg:
+			default:
+				flooded = true
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(v) == nil
+	}
+	closeWith := func(code int, reason string) {
+		msg := websocket.FormatCloseMessage(code, reason)
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+	}
+	send := func(ev services.Event) bool {
+		for _, t := range ev.Topics() {
+			if topics[t] {
+				return write(ev)
+			}
+		}
+		return true
+	}
+
+	if !write(wsMessage{Type: "subscribed", Topics: sortedTopics(topics)}) {
+		return
+	}
+	if sub.Missed {
+		if !write(wsMessage{Type: "reset"}) {
+			return
+		}
+	}
+	for _, ev := range sub.Replay {
+		if !send(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(h.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				if h.bus.Closed() {
+					closeWith(websocket.CloseGoingAway, "server shutting down")
+				} else {
+					closeWith(websocket.CloseTryAgainLater, "too slow, reconnect with last_event_id")
+				}
+				return
+			}
+			if !send(ev) {
+				return
+			}
+		case msg := <-requests:
+			var reply wsMessage
+			switch msg.Type {
+			case "subscribe":
+				addTopics(topics, msg.Topics)
+				reply = wsMessage{Type: "subscribed", Topics: sortedTopics(topics)}
+			case "unsubscribe":
+				for _, t := range msg.Topics {
+					delete(topics, strings.TrimSpace(t))
+				}
+				reply = wsMessage{Type: "subscribed", Topics: sortedTopics(topics)}
+			case "ping":
+				reply = wsMessage{Type: "pong"}
+			default:
+				reply = wsMessage{Type: "error", Error: `unknown request, want {"type": "subscribe" | "unsubscribe" | "ping"}`}
+			}
+			if !write(reply) {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-closed:
+			if flooded {
+				closeWith(websocket.ClosePolicyViolation, "too many requests")
+			}
+			return
+		case <-c.Request.Context().Done():
+			closeWith(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+func addTopics(topics map[string]bool, list []string) {
+	for _, t := range list {
+		if t = strings.TrimSpace(t); t != "" {
+			topics[t] = true
+		}
+	}
+}
+
+func sortedTopics(topics map[string]bool) []string {
+	list := make([]string, 0, len(topics))
+	for t := range topics {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// originAllowed accepts requests without an Origin, from the serving host, or from one of allowed.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
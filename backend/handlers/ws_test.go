@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"blog-suiseiseki/models"
+	"blog-suiseiseki/services"
+)
+
+func newWSServer(t *testing.T, h *WSHandler) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/ws", h.Serve)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws"
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v (%v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// readWS returns the next message as a map.
+func readWS(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	var msg map[string]interface{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestWS_Topics(t *testing.T) {
+	bus := services.NewEventBus(0)
+	conn := dialWS(t, newWSServer(t, NewWSHandler(bus, nil))+"?topics=slug:a,category:go")
+
+	if msg := readWS(t, conn); msg["type"] != "subscribed" || len(msg["topics"].([]interface{})) != 2 {
+		t.Fatalf("want subscribed ack with 2 topics, got %v", msg)
+	}
+
+	bus.Publish(services.EventPostUpdated, services.PostEvent{Source: "default", Slug: "b"})
+	bus.Publish(services.EventSyncCompleted, models.SyncRun{Source: "default"})
+	bus.Publish(services.EventPostUpdated, services.PostEvent{Source: "default", Slug: "a"})
+	bus.Publish(services.EventPostCreated, services.PostEvent{Source: "default", Slug: "c", Category: "go"})
+	if msg := readWS(t, conn); msg["id"] != float64(3) || msg["data"].(map[string]interface{})["slug"] != "a" {
+		t.Errorf("want only the event for slug a first, got %v", msg)
+	}
+	if msg := readWS(t, conn); msg["id"] != float64(4) || msg["type"] != services.EventPostCreated {
+		t.Errorf("want the event for category go, got %v", msg)
+	}
+
+	conn.WriteJSON(map[string]interface{}{"type": "subscribe", "topics": []string{"sync"}})
+	if msg := readWS(t, conn); msg["type"] != "subscribed" || len(msg["topics"].([]interface{})) != 3 {
+		t.Fatalf("want subscribed ack with 3 topics, got %v", msg)
+	}
+	bus.Publish(services.EventSyncFailed, models.SyncRun{Source: "default", Error: "boom"})
+	if msg := readWS(t, conn); msg["type"] != services.EventSyncFailed {
+		t.Errorf("want sync_failed after subscribing to sync, got %v", msg)
+	}
+
+	conn.WriteJSON(map[string]string{"type": "ping"})
+	if msg := readWS(t, conn); msg["type"] != "pong" {
+		t.Errorf("want pong, got %v", msg)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if msg := readWS(t, conn); msg["type"] != "error" {
+		t.Errorf("want error for an invalid request, got %v", msg)
+	}
+}
+
+func TestWS_Keepalive(t *testing.T) {
+	handler := NewWSHandler(services.NewEventBus(0), nil)
+	handler.SetPingInterval(20 * time.Millisecond)
+	url := newWSServer(t, handler)
+
+	for _, answer := range []bool{true, false} {
+		conn := dialWS(t, url)
+		readWS(t, conn) // subscribed
+		var pings atomic.Int32
+		conn.SetPingHandler(func(string) error {
+			pings.Add(1)
+			if !answer {
+				return nil
+			}
+			return conn.WriteControl(websocket.PongMessage, nil, time.Now().Add(time.Second))
+		})
+
+		// Pings are handled while blocked in the read below
+		time.AfterFunc(150*time.Millisecond, func() { conn.WriteJSON(map[string]string{"type": "ping"}) })
+		var msg map[string]interface{}
+		err := conn.ReadJSON(&msg)
+		if answer && (err != nil || msg["type"] != "pong" || pings.Load() < 2) {
+			t.Errorf("want a client answering pings kept, got %v, %v after %d pings", msg, err, pings.Load())
+		}
+		if !answer && err == nil {
+			t.Errorf("want a client not answering pings dropped, got %v", msg)
+		}
+	}
+}
+
+func TestWS_Replay(t *testing.T) {
+	bus := services.NewEventBus(0)
+	for _, slug := range []string{"a", "b", "c"} {
+		bus.Publish(services.EventPostUpdated, services.PostEvent{Slug: slug})
+	}
+	conn := dialWS(t, newWSServer(t, NewWSHandler(bus, nil))+"?last_event_id=2")
+
+	readWS(t, conn) // subscribed
+	if msg := readWS(t, conn); msg["id"] != float64(3) {
+		t.Errorf("want event 3 replayed, got %v", msg)
+	}
+}
+
+func TestWS_Shutdown(t *testing.T) {
+	bus := services.NewEventBus(0)
+	conn := dialWS(t, newWSServer(t, NewWSHandler(bus, nil)))
+	readWS(t, conn) // subscribed
+
+	bus.Close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("want close 1001 when the bus closes, got %v", err)
+	}
+}
+
+func TestWS_Origin(t *testing.T) {
+	url := newWSServer(t, NewWSHandler(services.NewEventBus(0), []string{"https://widgets.example.com"}))
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://widgets.example.com", true},
+		{"https://evil.example.com", false},
+		{"", true}, // non-browser clients
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		if (err == nil) != tt.want {
+			t.Errorf("origin %q: want allowed %t, got err %v", tt.origin, tt.want, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestWS_SlowClientDropped(t *testing.T) {
+	bus := services.NewEventBus(0)
+	conn := dialWS(t, newWSServer(t, NewWSHandler(bus, nil)))
+	readWS(t, conn) // subscribed
+
+	// Without reading, the socket buffers fill, the writer blocks and the bus drops the subscriber
+	big := strings.Repeat("x", 256<<10)
+	for i := 0; i < 150; i++ {
+		bus.Publish(services.EventPostUpdated, services.PostEvent{Slug: big})
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for n := 0; ; n++ {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+				t.Fatalf("want close 1013 after %d messages, got %v", n, err)
+			}
+			if n >= 150 {
+				t.Errorf("want some events dropped, got all %d", n)
+			}
+			return
+		}
+		var ev services.Event
+		json.Unmarshal(data, &ev)
+	}
+}
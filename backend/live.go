@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"blog-suiseiseki/config"
+)
+
+// liveConfig is the part of the config a running server applies on reload. A reload builds a
+// complete new one and swaps it in with a single pointer store, so a request sees either the
+// old or the new settings, never a mix.
+type liveConfig struct {
+	syncInterval   time.Duration
+	webhookSecrets map[string]string // by source name
+	logLevel       string
+	logLevels      map[string]string
+}
+
+func newLiveConfig(cfg *config.Config) *liveConfig {
+	live := &liveConfig{
+		syncInterval:   time.Duration(cfg.SyncIntervalMinutes) * time.Minute,
+		webhookSecrets: make(map[string]string, len(cfg.Sources)),
+		logLevel:       cfg.LogLevel,
+		logLevels:      cfg.LogLevels,
+	}
+	for _, src := range cfg.Sources {
+		live.webhookSecrets[src.Name] = src.WebhookSecret
+	}
+	return live
+}
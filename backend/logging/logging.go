@@ -0,0 +1,212 @@
+// Package logging sets up log/slog: text or JSON output, a level per component (sync, http,
+// webhook, ...) that can change at runtime, and the request ID of the HTTP request a record
+// was logged for.
+//
+// Loggers are created with New("component") as package variables before Setup runs; they
+// always write through the handler Setup installed last.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ComponentKey is the attribute naming the part of the server that logged a record.
+const ComponentKey = "component"
+
+// RequestIDKey is the attribute carrying the request ID.
+const RequestIDKey = "request_id"
+
+var (
+	base   atomic.Pointer[slog.Handler] // text or JSON handler from Setup
+	levels = &levelSet{def: slog.LevelInfo}
+)
+
+func init() {
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	base.Store(&h)
+}
+
+// Setup writes logs to w as "text" or "json" and sets the levels (see SetLevels). Records of
+// the standard log package go through it too, at info level.
+func Setup(w io.Writer, format string, level string, componentLevels map[string]string) error {
+	var h slog.Handler
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // levels are checked per component
+	switch format {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	if err := SetLevels(level, componentLevels); err != nil {
+		return err
+	}
+	base.Store(&h)
+	slog.SetDefault(slog.New(&handler{}))
+	log.SetFlags(0) // slog adds the time
+	return nil
+}
+
+// SetLevels sets the minimum level (debug, info, warn or error) of all components and the
+// overrides of single components, e.g. {"sync": "debug"}. It is safe to call while logging.
+func SetLevels(level string, componentLevels map[string]string) error {
+	def, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	comps := make(map[string]slog.Level, len(componentLevels))
+	for c, l := range componentLevels {
+		if comps[c], err = ParseLevel(l); err != nil {
+			return fmt.Errorf("component %s: %w", c, err)
+		}
+	}
+	levels.set(def, comps)
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error; empty means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+}
+
+// ParseComponentLevels parses "sync=debug,http=warn" as used by LOG_LEVELS.
+func ParseComponentLevels(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		c, l, ok := strings.Cut(pair, "=")
+		if !ok || c == "" {
+			return nil, fmt.Errorf("%q is not component=level", pair)
+		}
+		m[strings.TrimSpace(c)] = strings.TrimSpace(l)
+	}
+	return m, nil
+}
+
+// New returns the logger of a component.
+func New(component string) *slog.Logger {
+	return slog.New(&handler{component: component, attrs: []slog.Attr{slog.String(ComponentKey, component)}})
+}
+
+type ctxKey struct{}
+
+// WithRequestID returns ctx carrying the request ID; records logged with it include the ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the request ID ctx carries, empty when none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// levelSet holds the default level and the per-component overrides.
+type levelSet struct {
+	mu    sync.RWMutex
+	def   slog.Level
+	comps map[string]slog.Level
+}
+
+func (s *levelSet) set(def slog.Level, comps map[string]slog.Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.def, s.comps = def, comps
+}
+
+func (s *levelSet) level(component string) slog.Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if l, ok := s.comps[component]; ok {
+		return l
+	}
+	return s.def
+}
+
+// String lists the levels, e.g. "info (sync=debug)", for logging a reload.
+func (s *levelSet) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var comps []string
+	for c, l := range s.comps {
+		comps = append(comps, c+"="+strings.ToLower(l.String()))
+	}
+	sort.Strings(comps)
+	if len(comps) == 0 {
+		return strings.ToLower(s.def.String())
+	}
+	return fmt.Sprintf("%s (%s)", strings.ToLower(s.def.String()), strings.Join(comps, ", "))
+}
+
+// Levels describes the current levels, e.g. "info (sync=debug)".
+func Levels() string {
+	return levels.String()
+}
+
+// handler filters by the level of its component and hands records to the current base
+// handler. Attributes and groups added with With are replayed on the base for each record,
+// so loggers created before Setup follow it.
+type handler struct {
+	component string
+	attrs     []slog.Attr
+	ops       []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= levels.level(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	b := *base.Load()
+	if len(h.attrs) > 0 {
+		b = b.WithAttrs(h.attrs)
+	}
+	for _, op := range h.ops {
+		b = op(b)
+	}
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return b.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	if len(h.ops) == 0 {
+		next.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	} else {
+		next.ops = append(append([]func(slog.Handler) slog.Handler(nil), h.ops...), func(b slog.Handler) slog.Handler { return b.WithAttrs(attrs) })
+	}
+	return &next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.ops = append(append([]func(slog.Handler) slog.Handler(nil), h.ops...), func(b slog.Handler) slog.Handler { return b.WithGroup(name) })
+	return &next
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { Setup(os.Stderr, "text", "info", nil) })
+	syncLog, httpLog := New("sync"), New("http") // created before Setup, as package variables are
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "json", "info", map[string]string{"sync": "debug", "http": "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithRequestID(context.Background(), "req-1")
+	syncLog.DebugContext(ctx, "fetching", "run", 3)
+	httpLog.Info("request") // below http's warn level
+	httpLog.With("route", "/x").Warn("slow")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 records, got %d:\n%s", len(lines), buf.String())
+	}
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first["component"] != "sync" || first["msg"] != "fetching" || first["request_id"] != "req-1" || first["run"] != 3.0 {
+		t.Errorf("unexpected sync record %v", first)
+	}
+	if second["component"] != "http" || second["route"] != "/x" || second["request_id"] != nil {
+		t.Errorf("unexpected http record %v", second)
+	}
+
+	// Levels change at runtime; the format stays
+	buf.Reset()
+	if err := SetLevels("error", nil); err != nil {
+		t.Fatal(err)
+	}
+	syncLog.Debug("hidden")
+	httpLog.Warn("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("want no records at error level, got:\n%s", buf.String())
+	}
+	if got := Levels(); got != "error" {
+		t.Errorf("Levels() = %q, want error", got)
+	}
+
+	buf.Reset()
+	if err := Setup(&buf, "text", "info", nil); err != nil {
+		t.Fatal(err)
+	}
+	syncLog.Info("done", "run", 4)
+	if got := buf.String(); !strings.Contains(got, "msg=done component=sync run=4") {
+		t.Errorf("unexpected text record %q", got)
+	}
+
+	if err := Setup(&buf, "xml", "info", nil); err == nil {
+		t.Error("want an error for an unknown format")
+	}
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"sync=debug", map[string]string{"sync": "debug"}, false},
+		{" sync = debug , http=warn,", map[string]string{"sync": "debug", "http": "warn"}, false},
+		{"sync", nil, true},
+		{"=debug", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseComponentLevels(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+			}
+		}
+	}
+}
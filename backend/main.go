@@ -1,9 +1,18 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,48 +20,33 @@ import (
 	"blog-suiseiseki/config"
 	"blog-suiseiseki/database"
 	"blog-suiseiseki/handlers"
+	"blog-suiseiseki/logging"
+	"blog-suiseiseki/metrics"
 	"blog-suiseiseki/services"
 )
 
-// syncNotifier broadcasts to SSE subscribers when sync completes so the frontend can refresh the list.
-type syncNotifier struct {
-	mu   sync.Mutex
-	subs []chan struct{}
-}
+var logger = logging.New("server")
 
-func (n *syncNotifier) Subscribe() (ch <-chan struct{}, unsubscribe func()) {
-	c := make(chan struct{}, 1)
-	n.mu.Lock()
-	n.subs = append(n.subs, c)
-	n.mu.Unlock()
-	return c, func() {
-		n.mu.Lock()
-		defer n.mu.Unlock()
-		for i, s := range n.subs {
-			if s == c {
-				n.subs = append(n.subs[:i], n.subs[i+1:]...)
-				close(c)
-				break
-			}
-		}
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		exitConfigInvalid(err)
 	}
-}
-
-func (n *syncNotifier) Broadcast() {
-	n.mu.Lock()
-	subs := make([]chan struct{}, len(n.subs))
-	copy(subs, n.subs)
-	n.mu.Unlock()
-	for _, ch := range subs {
-		select {
-		case ch <- struct{}{}:
-		default:
+	// --print-config shows the merged config and where each value came from, then checks it
+	if len(os.Args) > 1 && os.Args[1] == "--print-config" {
+		cfg.PrintEffective(os.Stdout)
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr)
+			exitConfigInvalid(err)
 		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		exitConfigInvalid(err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel, cfg.LogLevels); err != nil {
+		exitConfigInvalid(err)
 	}
-}
-
-func main() {
-	cfg := config.Load()
 
 	if cfg.IsDev {
 		gin.SetMode(gin.DebugMode)
@@ -62,57 +56,287 @@ func main() {
 
 	db, err := database.New(cfg.DBPath)
 	if err != nil {
-		log.Fatalf("db init failed: %v", err)
+		fatal("db init failed", "error", err)
 	}
 	defer db.Close()
 
-	log.Printf("db initialized: %s", cfg.DBPath)
+	logger.Info("db initialized", "path", cfg.DBPath)
 
-	syncNotifier := &syncNotifier{}
-	syncService := services.NewSyncService(db.Conn(), cfg.PostsPath, cfg.IsDev, syncNotifier, cfg.PostsRemoteURL)
+	// stopping is done on SIGINT/SIGTERM. ctx, which every sync and request derives from, outlives
+	// it by up to the shutdown timeout so in-flight requests and syncs can finish.
+	stopping, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// syncers stop starting syncs once stopping is done; workers run until ctx is cancelled
+	var syncers, workers sync.WaitGroup
 
-	if cfg.IsDev {
-		if cfg.PostsRemoteURL != "" {
-			log.Println("dev: running initial sync (may clone remote), then starting server...")
-			if err := syncService.Sync(); err != nil {
-				log.Printf("initial sync failed: %v", err)
+	events := services.NewEventBus(services.DefaultEventBuffer)
+	gitBackend, err := services.NewGitBackend(cfg.GitBackend)
+	if err != nil {
+		fatal("sync config invalid", "error", err)
+	}
+	// One SyncService per content source; they share the posts table, each owning its own rows
+	var syncServices []*services.SyncService
+	hasRemote := false
+	for _, src := range cfg.Sources {
+		syncService := services.NewSyncService(db.Conn(), src.Path, cfg.IsDev, events, src.RemoteURL)
+		syncService.SetSource(src.Name)
+		syncService.SetPostDefaults(src.SlugPrefix, src.Category)
+		syncService.SetGitTimeout(time.Duration(cfg.GitTimeoutSeconds) * time.Second)
+		syncService.SetGitBackend(gitBackend)
+		syncService.SetBranch(src.Branch)
+		syncService.SetCleanUntracked(cfg.SyncCleanUntracked)
+		syncService.SetRollbackDepth(cfg.RollbackDepth)
+		switch src.Type {
+		case services.ContentDir:
+			syncService.SetContentSource(services.NewDirSource(src.Path))
+		case services.ContentArchive:
+			syncService.SetContentSource(services.NewArchiveSource(src.RemoteURL, src.Path))
+		case services.ContentS3:
+			s3 := services.NewS3Source(services.S3Config{
+				Endpoint:  src.S3.Endpoint,
+				Region:    src.S3.Region,
+				Bucket:    src.S3.Bucket,
+				Prefix:    src.S3.Prefix,
+				AccessKey: src.S3.AccessKey,
+				SecretKey: src.S3.SecretKey,
+			}, src.Path)
+			s3.SetETagStore(db.Conn(), src.Name)
+			syncService.SetContentSource(s3)
+		}
+		syncServices = append(syncServices, syncService)
+		hasRemote = hasRemote || src.RemoteURL != "" || src.Type == services.ContentS3
+	}
+	sources := services.NewSources(syncServices...)
+
+	if len(os.Args) > 1 {
+		code := runCommand(stopping, sources, os.Args[1:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	// Only the server sends outbound webhooks. They subscribe before the first sync (and the
+	// prune), so its events are sent too
+	var outbound *services.Outbound
+	if len(cfg.NotifyWebhooks) > 0 {
+		hooks := make([]services.OutboundWebhook, 0, len(cfg.NotifyWebhooks))
+		for _, h := range cfg.NotifyWebhooks {
+			hooks = append(hooks, services.OutboundWebhook{URL: h.URL, Secret: h.Secret, Events: h.Events})
+		}
+		outbound = services.NewOutbound(db.Conn(), events, hooks)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			outbound.Run(ctx)
+		}()
+		logger.Info("outbound webhooks enabled", "webhooks", len(hooks))
+	}
+
+	if err := sources.Prune(ctx); err != nil {
+		logger.Error("prune sources failed", "error", err)
+	}
+
+	// Closed once the initial sync is done; systemd is told the service is ready after it
+	initialSync := make(chan struct{})
+	if !cfg.IsDev {
+		syncers.Add(1)
+		go func() {
+			defer syncers.Done()
+			defer close(initialSync)
+			// Catch up on pushes missed while stopped; requests are served from the DB meanwhile
+			if err := sources.SyncChanged(ctx, services.TriggerStartup); err != nil {
+				logger.Error("startup sync failed", "error", err)
 			}
+		}()
+	} else {
+		if hasRemote {
+			logger.Info("dev: running initial sync (may clone remote), then starting server")
+			// Nothing to drain yet: a signal cancels the clone right away
+			if err := sources.SyncAll(stopping, services.TriggerStartup); err != nil {
+				logger.Error("initial sync failed", "error", err)
+			}
+			close(initialSync)
+			sources.Watch(ctx, services.DefaultWatchDebounce)
 		} else {
+			syncers.Add(1)
 			go func() {
-				log.Println("dev: running initial sync...")
-				if err := syncService.Sync(); err != nil {
-					log.Printf("initial sync failed: %v", err)
+				defer syncers.Done()
+				logger.Info("dev: running initial sync")
+				if err := sources.SyncAll(ctx, services.TriggerStartup); err != nil {
+					logger.Error("initial sync failed", "error", err)
 				}
+				close(initialSync)
+				// Reindex posts on save instead of waiting for the ticker
+				sources.Watch(ctx, services.DefaultWatchDebounce)
 			}()
 		}
 	}
 
-	if cfg.SyncIntervalMinutes > 0 {
-		interval := time.Duration(cfg.SyncIntervalMinutes) * time.Minute
-		log.Printf("sync: interval %d min", cfg.SyncIntervalMinutes)
+	// Settings a reload changes; handlers read them per request
+	var live atomic.Pointer[liveConfig]
+	live.Store(newLiveConfig(cfg))
+
+	scheduler := services.NewScheduler(sources, live.Load().syncInterval)
+	syncers.Add(1)
+	go func() {
+		defer syncers.Done()
+		scheduler.Run(ctx, stopping.Done())
+	}()
+
+	primary := cfg.Sources[0]
+	postsHandler := handlers.NewPostsHandler(db.Conn(), primary.Path)
+	var sourceLinks *services.SourceLinks
+	for i, src := range cfg.Sources {
+		var links *services.SourceLinks
+		if src.Type == services.ContentGit {
+			links, err = services.NewSourceLinks(src.RemoteURL, src.Branch, cfg.SourceProvider, cfg.SourceURLTemplate, cfg.SourceHistoryTemplate)
+			if err != nil {
+				fatal("source_links config invalid", "source", src.Name, "error", err)
+			}
+			if links == nil && src.RemoteURL != "" {
+				logger.Warn("source links disabled: cannot tell the provider, set source_links.provider", "remote", src.RemoteURL)
+			}
+			if links != nil && src.Branch == "" {
+				// Link to the default branch by name: Gitea has no src/branch/HEAD
+				syncService := sources.Get(src.Name)
+				links.SetBranchResolver(func() (string, error) {
+					return syncService.DefaultBranch(context.Background())
+				})
+			}
+		}
+		if i == 0 {
+			sourceLinks = links
+			if links != nil {
+				postsHandler.SetSourceLinks(links)
+			}
+			continue
+		}
+		postsHandler.AddSource(src.Name, src.Path, links)
+	}
+	webhookProviders, err := handlers.WebhookProviders(cfg.WebhookProviders)
+	if err != nil {
+		fatal("webhook config invalid", "error", err)
+	}
+	deliveries := services.NewDeliveryLog(db.Conn())
+	webhookHandlers := make(map[string]*handlers.WebhookHandler)
+	for _, src := range cfg.Sources {
+		name := src.Name
+		h := handlers.NewWebhookHandler(sources.Get(name), deliveries, webhookProviders, src.WebhookSecret, src.WebhookBranch)
+		h.SetSecretFunc(func() string { return live.Load().webhookSecrets[name] })
+		webhookHandlers[name] = h
+	}
+	webhookHandler := webhookHandlers[primary.Name]
+
+	var previews *services.PreviewManager
+	if cfg.PreviewEnabled {
+		if primary.RemoteURL == "" {
+			fatal("preview config invalid: preview.enabled requires posts.remote_url")
+		}
+		previews = services.NewPreviewManager(cfg.PreviewPath, primary.RemoteURL, gitBackend, time.Duration(cfg.GitTimeoutSeconds)*time.Second)
+		previews.SetMax(cfg.PreviewMax)
+		if err := previews.Load(); err != nil {
+			logger.Error("load previews failed", "error", err)
+		}
+		webhookHandler.SetPreviews(previews)
+		logger.Info("previews enabled", "dir", cfg.PreviewPath, "max", cfg.PreviewMax)
+	}
+	historyHandler := handlers.NewHistoryHandler(db.Conn(), sources)
+	syncHandler := handlers.NewSyncHandler(sources)
+	// Run errors can name remote URLs and paths: the public endpoints are redacted
+	adminSyncHandler := handlers.NewSyncHandler(sources)
+	adminSyncHandler.SetDetailed(true)
+	adminHandler := handlers.NewAdminHandler(sources)
+	if outbound != nil {
+		adminHandler.SetOutbound(outbound)
+	}
+
+	wsHandler := handlers.NewWSHandler(events, cfg.WSAllowedOrigins)
+
+	// SIGHUP or saving the config file reloads it. A config that fails to load or validate is
+	// rejected as a whole; otherwise the live settings are swapped in and the rest is reported
+	reloads := make(chan string, 1)
+	requestReload := func(why string) {
+		select {
+		case reloads <- why:
+		default: // a reload is already pending
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			requestReload("SIGHUP")
+		}
+	}()
+	if path := cfg.File(); path != "" {
 		go func() {
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-			for range ticker.C {
-				if err := syncService.Sync(); err != nil {
-					log.Printf("periodic sync failed: %v", err)
-				}
+			if err := config.WatchFile(ctx, path, services.DefaultWatchDebounce, func() { requestReload("file changed") }); err != nil {
+				logger.Error("watch config failed", "error", err)
 			}
 		}()
 	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		running := cfg
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case why := <-reloads:
+				next, err := config.Load()
+				if err == nil {
+					err = next.Validate()
+				}
+				if err != nil {
+					logger.Error("config reload rejected, keeping the running config", "reason", why, "error", err)
+					continue
+				}
+				applied, restart := config.Changes(running, next)
+				state := newLiveConfig(next)
+				prev := live.Swap(state)
+				// The scheduler's ticker and the log handlers are told after the swap
+				if state.syncInterval != prev.syncInterval {
+					scheduler.SetInterval(state.syncInterval)
+				}
+				logging.SetLevels(state.logLevel, state.logLevels) // validated above
+				running = config.ApplyLive(running, next)
 
-	postsHandler := handlers.NewPostsHandler(db.Conn(), cfg.PostsPath)
-	webhookHandler := handlers.NewWebhookHandler(syncService, cfg.WebhookSecret)
+				switch {
+				case len(applied) > 0:
+					logger.Info("config reloaded", "reason", why, "applied", applied)
+				case len(restart) == 0:
+					logger.Info("config reloaded, nothing changed", "reason", why)
+				}
+				if len(restart) > 0 {
+					logger.Warn("config changed, restart to apply", "settings", restart)
+				}
+			}
+		}
+	}()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(handlers.RequestID(), handlers.AccessLog(), gin.Recovery())
 	// Trust only local reverse proxy (Caddy/nginx); avoids "trusted all proxies" warning
 	r.SetTrustedProxies([]string{"127.0.0.1", "::1"})
 
+	if cfg.MetricsEnabled {
+		r.Use(handlers.Metrics())
+		metrics.NewGaugeFunc("blog_posts_indexed", "Posts in the index, all sources.", func() float64 {
+			var n int
+			if err := db.Conn().QueryRow("SELECT COUNT(*) FROM posts").Scan(&n); err != nil {
+				return math.NaN()
+			}
+			return float64(n)
+		})
+	}
+
 	if cfg.IsDev {
 		r.Use(func(c *gin.Context) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Hub-Signature-256")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Hub-Signature-256, X-GitHub-Event, X-GitHub-Delivery, X-Gitlab-Token, X-Gitlab-Event, X-Gitea-Signature, X-Gitea-Event, X-Hub-Signature, X-Event-Key")
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
 				return
@@ -124,40 +348,281 @@ func main() {
 	api := r.Group("/api")
 	{
 		api.POST("/webhook", webhookHandler.HandleWebhook)
+		// Each source also has its own webhook URL, e.g. /api/webhook/essays
+		for name, h := range webhookHandlers {
+			api.POST("/webhook/"+name, h.HandleWebhook)
+		}
 		api.GET("/posts", postsHandler.GetPosts)
 		api.GET("/posts/:slug", postsHandler.GetPost)
+		api.GET("/posts/:slug/history", historyHandler.GetHistory)
+		api.GET("/posts/:slug/diff", historyHandler.GetDiff)
+		api.GET("/sync/status", syncHandler.GetStatus)
+		api.GET("/sync/history", syncHandler.GetHistory)
 		// Static assets from posts repo for relative paths in Markdown
 		api.GET("/posts-assets/*path", postsHandler.ServePostAsset)
-		// SSE: push on sync completion so frontend can refresh list without full reload
-		api.GET("/events", func(c *gin.Context) {
-			ch, unsub := syncNotifier.Subscribe()
-			defer unsub()
-			c.Header("Content-Type", "text/event-stream")
-			c.Header("Cache-Control", "no-cache")
-			c.Header("Connection", "keep-alive")
-			c.Header("X-Accel-Buffering", "no")
-			c.Writer.Flush()
-			for {
-				select {
-				case <-ch:
-					c.SSEvent("sync_completed", nil)
-					c.Writer.Flush()
-				case <-c.Request.Context().Done():
-					return
-				}
-			}
-		})
+		api.GET("/sources/:source/posts-assets/*path", postsHandler.ServePostAsset)
+		// SSE: post and sync events so the frontend can refresh without full reload
+		api.GET("/events", handlers.NewEventsHandler(events).Stream)
+		// WebSocket: the same events, filtered by topic, for clients that cannot use SSE
+		api.GET("/ws", wsHandler.Serve)
+
+		// Branch previews, served through the same PostsHandler code paths
+		if previews != nil {
+			previewHandler := handlers.NewPreviewHandler(previews)
+			previewHandler.SetSourceLinks(sourceLinks)
+			api.GET("/previews", previewHandler.ListPreviews)
+			api.GET("/preview/:branch/posts", previewHandler.GetPosts)
+			api.GET("/preview/:branch/posts/:slug", previewHandler.GetPost)
+			api.GET("/preview/:branch/posts-assets/*path", previewHandler.ServePostAsset)
+		}
+
+		// Admin: requires ADMIN_TOKEN as bearer token (open in dev when unset)
+		admin := api.Group("/admin", handlers.AdminAuth(cfg.AdminToken, cfg.IsDev))
+		admin.GET("/diagnostics", adminHandler.GetDiagnostics)
+		admin.POST("/sync", adminHandler.TriggerSync)
+		admin.GET("/sync/status", adminSyncHandler.GetStatus)
+		admin.GET("/sync/history", adminSyncHandler.GetHistory)
+		admin.GET("/pin", adminHandler.GetPin)
+		admin.POST("/pin", adminHandler.Pin)
+		admin.DELETE("/pin", adminHandler.Unpin)
+		admin.GET("/rollback", adminHandler.GetRollbackTargets)
+		admin.POST("/rollback", adminHandler.Rollback)
+		admin.GET("/outbound-deliveries", adminHandler.GetOutboundDeliveries)
 	}
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
-	addr := ":" + cfg.Port
-	log.Printf("server listening on %s (mode: %s)", addr, cfg.Mode)
-	log.Printf("posts path: %s", cfg.PostsPath)
+	// Prometheus: on the main port, or only on metrics.listen to keep it off the public port
+	var metricsSrv *http.Server
+	switch {
+	case cfg.MetricsListen != "":
+		mr := gin.New()
+		mr.GET("/metrics", handlers.ServeMetrics(cfg.MetricsToken))
+		metricsSrv = &http.Server{Addr: cfg.MetricsListen, Handler: mr}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("metrics server run failed", "error", err)
+			}
+		}()
+		logger.Info("serving metrics", "url", "http://"+cfg.MetricsListen+"/metrics")
+	case cfg.MetricsEnabled:
+		r.GET("/metrics", handlers.ServeMetrics(cfg.MetricsToken))
+	}
+
+	// Sockets passed by systemd (socket activation) take precedence over server.socket and server.port
+	listeners, err := services.ListenFDs()
+	if err != nil {
+		fatal("server listen failed", "error", err)
+	}
+	switch {
+	case len(listeners) > 0:
+		for _, l := range listeners {
+			logger.Info("server listening on socket from systemd", "addr", l.Addr().String(), "mode", cfg.Mode)
+		}
+	case cfg.SocketPath != "":
+		l, err := services.ListenUnix(cfg.SocketPath)
+		if err != nil {
+			fatal("server listen failed", "error", err)
+		}
+		listeners = append(listeners, l)
+		logger.Info("server listening", "addr", "unix:"+cfg.SocketPath, "mode", cfg.Mode)
+	default:
+		l, err := net.Listen("tcp", ":"+cfg.Port)
+		if err != nil {
+			fatal("server listen failed", "error", err)
+		}
+		listeners = append(listeners, l)
+		logger.Info("server listening", "addr", l.Addr().String(), "mode", cfg.Mode)
+	}
+	for _, src := range cfg.Sources {
+		logger.Info("posts path", "source", src.Name, "path", src.Path)
+	}
+
+	srv := &http.Server{
+		Handler: r,
+		// Syncs started by requests outlive a disconnecting client but not the server
+		BaseContext: func(net.Listener) context.Context { return handlers.WithServerContext(ctx) },
+	}
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("server run failed", "error", err)
+			}
+		}(l)
+	}
+
+	// systemd (Type=notify): ready once serving, restarted when the watchdog pings stop
+	if interval := services.WatchdogInterval(); interval > 0 {
+		logger.Info("systemd watchdog enabled", "ping_every", interval/2)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			services.RunWatchdog(ctx, interval, func(ctx context.Context) error {
+				events.LastID() // blocks if the event bus is deadlocked
+				return db.Conn().PingContext(ctx)
+			})
+		}()
+	}
+	// Each git command of the startup sync may take up to the git timeout, and sources sync
+	// one after another: keep extending the start timeout until it is done
+	starting, started := context.WithCancel(ctx)
+	extending := make(chan struct{})
+	go func() {
+		defer close(extending)
+		services.ExtendStartTimeout(starting, 20*time.Second)
+	}()
+	select {
+	case <-initialSync:
+		started()
+		<-extending // no extension may arrive after READY
+		if err := services.SdNotify("READY=1\nSTATUS=serving"); err != nil {
+			logger.Warn("systemd notify failed", "error", err)
+		}
+	case <-stopping.Done():
+	}
+	started()
+	<-extending
+
+	<-stopping.Done()
+	stop() // a second signal kills the process
+	services.SdNotify("STOPPING=1")
+	timeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	logger.Info("shutting down: draining requests and syncs", "timeout", timeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+
+	// SSE and WebSocket streams never end by themselves
+	events.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("shutdown: requests still running, closing connections", "timeout", timeout)
+		srv.Close()
+	}
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+	idle := make(chan struct{})
+	go func() {
+		syncers.Wait()
+		sources.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-shutdownCtx.Done():
+		logger.Warn("shutdown: timed out, cancelling in-flight sync")
+	}
+	// Let a cancelled sync finish rolling back before the DB is closed
+	cancel()
+	<-idle
+	workers.Wait()
+	sources.Wait()
+	if previews != nil {
+		previews.Close()
+	}
+	if err := db.Close(); err != nil {
+		logger.Error("shutdown: close db failed", "error", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// exitConfigInvalid lists every config error, one per line, and exits.
+func exitConfigInvalid(err error) {
+	fmt.Fprintf(os.Stderr, "config invalid:\n  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	os.Exit(1)
+}
+
+const cliUsage = `usage: blog-suiseiseki [--source <name>] [command]
+       blog-suiseiseki --print-config
+
+Without a command the server starts. Commands act on the configured DB and the posts dir
+of one content source (default: the first):
+  pin [commit] [reason...]   hold the site at commit (default: the commit served now)
+  unpin                      follow the remote branch again
+  rollback                   list the recently synced commits
+  rollback <commit> [reason] pin the site to one of those commits
+
+Pin changes take effect on the next sync (interval, webhook or POST /api/admin/sync).
+--print-config shows the merged config.yaml and env settings with their origin and exits;
+the exit code is 1 when the config is invalid.
+`
+
+// runCommand executes a CLI command and returns the process exit code.
+func runCommand(ctx context.Context, sources *services.Sources, args []string) int {
+	syncService := sources.Primary()
+	if args[0] == "--source" {
+		if len(args) < 3 {
+			fmt.Fprint(os.Stderr, cliUsage)
+			return 2
+		}
+		if syncService = sources.Get(args[1]); syncService == nil {
+			fmt.Fprintf(os.Stderr, "unknown source %q (configured: %s)\n", args[1], strings.Join(sources.Names(), ", "))
+			return 2
+		}
+		args = args[2:]
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", args[0], err)
+		return 1
+	}
+
+	switch args[0] {
+	case "pin":
+		var commit string
+		if len(args) > 1 {
+			commit = args[1]
+		}
+		pin, err := syncService.Pin(ctx, commit, reasonArg(args, 2))
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("pinned to %.12s %q\n", pin.Commit, pin.Message)
+	case "unpin":
+		removed, err := syncService.Unpin(ctx)
+		if err != nil {
+			return fail(err)
+		}
+		if !removed {
+			fmt.Println("not pinned")
+			return 0
+		}
+		fmt.Println("unpinned; the next sync follows the remote branch")
+	case "rollback":
+		if len(args) == 1 {
+			commits, err := syncService.SyncedCommits(ctx)
+			if err != nil {
+				return fail(err)
+			}
+			for _, c := range commits {
+				fmt.Printf("%.12s  run %d  %s\n", c.Commit, c.RunID, c.SyncedAt.Local().Format("2006-01-02 15:04:05"))
+			}
+			return 0
+		}
+		pin, err := syncService.Rollback(ctx, args[1], reasonArg(args, 2))
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("rolled back: pinned to %.12s %q\n", pin.Commit, pin.Message)
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+	return 0
+}
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("server run failed: %v", err)
+func reasonArg(args []string, from int) string {
+	if len(args) <= from {
+		return ""
 	}
+	return strings.Join(args[from:], " ")
 }
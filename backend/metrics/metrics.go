@@ -0,0 +1,295 @@
+// Package metrics collects counters, gauges and histograms and exposes them in the Prometheus
+// text format (version 0.0.4). Metrics register in Default when created, so packages declare
+// them as package variables next to the code they instrument.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram buckets in seconds for request-sized latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics in the order they were created.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Default is the registry the New* functions register in and Handler serves.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all metrics in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler serves the metrics of r, e.g. at /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler serves the metrics of Default.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// vec holds the per-label-values state of a metric.
+type vec[T any] struct {
+	name, help, typ string
+	labels          []string
+	mu              sync.Mutex
+	series          map[string]*series[T]
+	newValue        func() T
+}
+
+type series[T any] struct {
+	values []string
+	value  T
+}
+
+func newVec[T any](name, help, typ string, labels []string, newValue func() T) *vec[T] {
+	v := &vec[T]{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series[T]), newValue: newValue}
+	if len(labels) == 0 {
+		v.with(nil) // a metric without labels is exposed from the start, as 0
+	}
+	return v
+}
+
+// with returns the series for the label values, creating it on first use; call with v.mu held.
+func (v *vec[T]) with(values []string) *series[T] {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series[T]{values: append([]string(nil), values...), value: v.newValue()}
+		v.series[key] = s
+	}
+	return s
+}
+
+// each calls fn for every series sorted by label values, with v.mu held.
+func (v *vec[T]) each(fn func(s *series[T])) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(v.series[k])
+	}
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.typ)
+}
+
+// Counter is a value that only goes up, e.g. requests served.
+type Counter struct {
+	*vec[float64]
+}
+
+// NewCounter registers a counter in Default; label values are passed to Inc and Add.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(name, help, "counter", labels, func() float64 { return 0 })}
+	Default.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.with(values).value += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w)
+	c.each(func(s *series[float64]) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, s.values, "", ""), formatFloat(s.value))
+	})
+}
+
+// Gauge is a value that goes up and down, e.g. open connections.
+type Gauge struct {
+	*vec[float64]
+}
+
+// NewGauge registers a gauge in Default; label values are passed to Set, Inc and Dec.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", labels, func() float64 { return 0 })}
+	Default.register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(values).value = value
+}
+
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(values).value += delta
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.header(w)
+	g.each(func(s *series[float64]) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelPairs(g.labels, s.values, "", ""), formatFloat(s.value))
+	})
+}
+
+// gaugeFunc is a gauge read when metrics are scraped, e.g. a row count.
+type gaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge in Default whose value fn returns at scrape time.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(name, &gaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, escapeHelp(g.help), g.name, g.name, formatFloat(g.fn()))
+}
+
+// Histogram counts observations, e.g. durations in seconds, in cumulative buckets.
+type Histogram struct {
+	*vec[*histogramValue]
+	buckets []float64
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram in Default with the given upper bounds (sorted
+// ascending); label values are passed to Observe.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{buckets: buckets}
+	h.vec = newVec(name, help, "histogram", labels, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(buckets))}
+	})
+	Default.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.with(values).value
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w)
+	h.each(func(s *series[*histogramValue]) {
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.value.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, s.values, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, s.values, "le", "+Inf"), s.value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, s.values, "", ""), formatFloat(s.value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, s.values, "", ""), s.value.count)
+	})
+}
+
+// labelPairs formats {name="value",...}, with an extra pair (e.g. le) when extraName is set.
+func labelPairs(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests.", "route", "status")
+	open := NewGauge("test_open", "Open\nconnections.")
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{.1, 1}, "route")
+	NewGaugeFunc("test_rows", "Rows.", func() float64 { return 42 })
+	NewCounter("test_unused_total", "Never incremented.")
+
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/b"\`, "500")
+	open.Inc()
+	open.Inc()
+	open.Dec()
+	latency.Observe(.05, "/a")
+	latency.Observe(.5, "/a")
+	latency.Observe(5, "/a")
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("want the Prometheus text content type, got %q", ct)
+	}
+	got := w.Body.String()
+	for _, want := range []string{
+		"# HELP test_requests_total Requests.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{route="/a",status="200"} 3` + "\n",
+		`test_requests_total{route="/b\"\\",status="500"} 1` + "\n",
+		"# HELP test_open Open\\nconnections.\n# TYPE test_open gauge\ntest_open 1\n",
+		`test_latency_seconds_bucket{route="/a",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{route="/a",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{route="/a",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{route="/a"} 5.55` + "\n",
+		`test_latency_seconds_count{route="/a"} 3` + "\n",
+		"# TYPE test_rows gauge\ntest_rows 42\n",
+		"test_unused_total 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
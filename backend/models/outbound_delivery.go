@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboundDelivery is one event POSTed, or still to be POSTed, to an outbound webhook.
+type OutboundDelivery struct {
+	ID            int64      `json:"id"`
+	URL           string     `json:"url"`
+	EventID       uint64     `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code,omitempty"` // of the last attempt
+	Error         string     `json:"error,omitempty"`         // of the last attempt
+	CreatedAt     time.Time  `json:"created_at"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
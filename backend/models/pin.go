@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Pin holds the posts repo at a fixed commit; syncs reset to it instead of the remote branch.
+type Pin struct {
+	Commit   string    `json:"commit"`
+	Message  string    `json:"message"`
+	Reason   string    `json:"reason,omitempty"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// SyncedCommit is a commit that a successful sync served, newest first in rollback listings.
+type SyncedCommit struct {
+	Commit   string    `json:"commit"`
+	RunID    int64     `json:"run_id"`
+	SyncedAt time.Time `json:"synced_at"`
+}
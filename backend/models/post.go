@@ -5,12 +5,23 @@ import "time"
 type Post struct {
 	ID          int       `json:"id"`
 	Slug        string    `json:"slug"`
+	Source      string    `json:"source"`
 	Title       string    `json:"title"`
 	Summary     string    `json:"summary"`
 	Category    string    `json:"category"`
 	PublishedAt time.Time `json:"published_at"`
 	ContentPath string    `json:"-"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// From git history: first and last commit that touched the file
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	CreatedBy      string     `json:"created_by,omitempty"`
+	LastModifiedAt *time.Time `json:"last_modified_at,omitempty"`
+	LastModifiedBy string     `json:"last_modified_by,omitempty"`
+
+	// Links to the file and its history on the hosting provider, when configured
+	SourceURL  string `json:"source_url,omitempty"`
+	HistoryURL string `json:"history_url,omitempty"`
 }
 
 type PostWithContent struct {
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// SyncRun records one execution of SyncService.Sync.
+type SyncRun struct {
+	ID           int64       `json:"id"`
+	Source       string      `json:"source"`
+	Trigger      string      `json:"trigger"`
+	Status       string      `json:"status"`
+	StartedAt    time.Time   `json:"started_at"`
+	FinishedAt   *time.Time  `json:"finished_at,omitempty"`
+	CommitBefore string      `json:"commit_before"`
+	CommitAfter  string      `json:"commit_after"`
+	Added        int         `json:"added"`
+	Updated      int         `json:"updated"`
+	Deleted      int         `json:"deleted"`
+	Error        string      `json:"error,omitempty"`
+	FileErrors   []FileError `json:"file_errors"`
+}
+
+// FileError is a problem with a single Markdown file during sync.
+// Line and Column point into the file when known (e.g. a front-matter YAML error).
+type FileError struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
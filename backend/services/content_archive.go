@@ -0,0 +1,297 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxArchiveSize bounds a downloaded archive and its extracted content.
+const maxArchiveSize = 512 << 20
+
+// ArchiveSource mirrors a .tar.gz / .tgz / .zip archive served over HTTP (e.g. a CI artifact)
+// into the posts dir. The archive is downloaded again only when its ETag or Last-Modified
+// changes; a single top-level directory in the archive is stripped.
+type ArchiveSource struct {
+	url    string
+	dir    DirSource
+	client *http.Client
+
+	etag         string
+	lastModified string
+}
+
+func NewArchiveSource(url, dir string) *ArchiveSource {
+	return &ArchiveSource{
+		url:    url,
+		dir:    DirSource{dir: dir},
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (a *ArchiveSource) Kind() string { return ContentArchive }
+
+func (a *ArchiveSource) Update(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(a.dir.dir); err == nil {
+		a.setConditional(req)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download archive failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return a.dir.Update(ctx)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download archive failed: %s", resp.Status)
+	}
+
+	format, err := archiveFormat(a.url, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	parent := filepath.Dir(a.dir.dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(parent, "posts-archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	n, err := io.Copy(tmpFile, io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return fmt.Errorf("download archive failed: %w", err)
+	}
+	if n > maxArchiveSize {
+		return fmt.Errorf("archive larger than %d bytes", maxArchiveSize)
+	}
+
+	tmpDir, err := os.MkdirTemp(parent, "posts-extract-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if format == "zip" {
+		err = extractZip(tmpFile, n, tmpDir)
+	} else if _, err = tmpFile.Seek(0, io.SeekStart); err == nil {
+		err = extractTarGz(tmpFile, tmpDir)
+	}
+	if err != nil {
+		return fmt.Errorf("extract archive failed: %w", err)
+	}
+	if err := replaceDir(a.dir.dir, stripSingleRoot(tmpDir)); err != nil {
+		return err
+	}
+
+	a.etag = resp.Header.Get("ETag")
+	a.lastModified = resp.Header.Get("Last-Modified")
+	syncLog.InfoContext(ctx, "archive update ok", "url", a.url, "bytes", n)
+	return a.dir.Update(ctx)
+}
+
+func (a *ArchiveSource) List(ctx context.Context) ([]string, error) {
+	return a.dir.List(ctx)
+}
+
+func (a *ArchiveSource) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return a.dir.ReadFile(ctx, path)
+}
+
+// Changed sends a conditional HEAD request; servers without ETag or Last-Modified always
+// count as changed.
+func (a *ArchiveSource) Changed(ctx context.Context) (bool, error) {
+	if a.etag == "" && a.lastModified == "" {
+		return true, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, a.url, nil)
+	if err != nil {
+		return false, err
+	}
+	a.setConditional(req)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			return etag != a.etag, nil
+		}
+		return resp.Header.Get("Last-Modified") != a.lastModified, nil
+	}
+	return false, fmt.Errorf("poll archive failed: %s", resp.Status)
+}
+
+func (a *ArchiveSource) setConditional(req *http.Request) {
+	if a.etag != "" {
+		req.Header.Set("If-None-Match", a.etag)
+	}
+	if a.lastModified != "" {
+		req.Header.Set("If-Modified-Since", a.lastModified)
+	}
+}
+
+// archiveFormat picks "zip" or "tar.gz" from the URL path, falling back to the content type.
+func archiveFormat(rawURL, contentType string) (string, error) {
+	p := strings.ToLower(rawURL)
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	switch {
+	case strings.HasSuffix(p, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return "tar.gz", nil
+	case strings.Contains(contentType, "zip") && !strings.Contains(contentType, "gzip"):
+		return "zip", nil
+	case strings.Contains(contentType, "gzip"):
+		return "tar.gz", nil
+	}
+	return "", fmt.Errorf("unknown archive format for %s (want .tar.gz, .tgz or .zip)", rawURL)
+}
+
+func extractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := archivePath(dest, hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxArchiveSize {
+				return fmt.Errorf("archive content larger than %d bytes", maxArchiveSize)
+			}
+			if err := writeArchiveFile(dest, hdr.Name, tr, hdr.ModTime); err != nil {
+				return err
+			}
+		}
+		// Links and special files are skipped
+	}
+}
+
+func extractZip(r io.ReaderAt, size int64, dest string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	var total uint64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() {
+			continue
+		}
+		total += f.UncompressedSize64
+		if total > maxArchiveSize {
+			return fmt.Errorf("archive content larger than %d bytes", maxArchiveSize)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(dest, f.Name, rc, f.Modified)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePath maps an archive entry name into dest, rejecting entries that escape it.
+func archivePath(dest, name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	local := filepath.FromSlash(name)
+	if name == "" || !filepath.IsLocal(local) {
+		return "", fmt.Errorf("invalid archive entry %q", name)
+	}
+	return filepath.Join(dest, local), nil
+}
+
+func writeArchiveFile(dest, name string, r io.Reader, modTime time.Time) error {
+	target, err := archivePath(dest, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Keep entry times so posts without a published_at keep a stable date
+	if !modTime.IsZero() {
+		os.Chtimes(target, modTime, modTime)
+	}
+	return nil
+}
+
+// stripSingleRoot returns the only subdirectory of dir when dir contains nothing else, as in
+// archives of a "posts/" folder or GitHub's "<repo>-<sha>/".
+func stripSingleRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// replaceDir swaps src into dst's place, removing the previous dst.
+func replaceDir(dst, src string) error {
+	old := dst + ".old"
+	os.RemoveAll(old)
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace posts dir: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Rename(old, dst)
+		return fmt.Errorf("failed to replace posts dir: %w", err)
+	}
+	os.RemoveAll(old)
+	return nil
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config addresses a prefix in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+// Requests use path-style URLs ({endpoint}/{bucket}/{key}); without keys they are anonymous.
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://127.0.0.1:9000
+	Region    string // default us-east-1
+	Bucket    string
+	Prefix    string // only keys under this prefix; the prefix is stripped from file paths
+	AccessKey string
+	SecretKey string
+}
+
+// S3Source mirrors the objects under a bucket prefix into the posts dir. Objects are
+// downloaded when their ETag changes and local files without an object are removed.
+type S3Source struct {
+	cfg    S3Config
+	dir    DirSource
+	client *http.Client
+	db     *sql.DB // optional ETag store, see SetETagStore
+	source string
+
+	etags map[string]string // by relative path, as of the last Update
+}
+
+func NewS3Source(cfg S3Config, dir string) *S3Source {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	return &S3Source{
+		cfg:    cfg,
+		dir:    DirSource{dir: dir},
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// SetETagStore keeps the ETags of the mirrored objects in the content_etags table under
+// source, so after a restart unchanged objects are not downloaded again and Changed does not
+// report a change on the first poll.
+func (s *S3Source) SetETagStore(db *sql.DB, source string) {
+	s.db = db
+	s.source = source
+}
+
+func (s *S3Source) Kind() string { return ContentS3 }
+
+func (s *S3Source) Update(ctx context.Context) error {
+	if err := s.loadETags(ctx); err != nil {
+		return err
+	}
+	objects, err := s.listObjects(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	etags := make(map[string]string, len(objects))
+	downloaded := 0
+	for rel, obj := range objects {
+		target := filepath.Join(s.dir.dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(target); err == nil && s.etags[rel] == obj.ETag {
+			etags[rel] = obj.ETag
+			continue
+		}
+		if err := s.download(ctx, obj, target); err != nil {
+			return err
+		}
+		etags[rel] = obj.ETag
+		downloaded++
+	}
+
+	local, err := listFiles(s.dir.dir)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, rel := range local {
+		if _, ok := objects[rel]; !ok {
+			if err := os.Remove(filepath.Join(s.dir.dir, filepath.FromSlash(rel))); err == nil {
+				removed++
+			}
+		}
+	}
+
+	if downloaded > 0 || len(etags) != len(s.etags) {
+		if err := s.saveETags(ctx, etags); err != nil {
+			return err
+		}
+	}
+	s.etags = etags
+	syncLog.InfoContext(ctx, "s3 update ok", "bucket", s.cfg.Bucket, "prefix", s.cfg.Prefix, "objects", len(objects), "downloaded", downloaded, "removed", removed)
+	return s.dir.Update(ctx)
+}
+
+func (s *S3Source) List(ctx context.Context) ([]string, error) {
+	return s.dir.List(ctx)
+}
+
+func (s *S3Source) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return s.dir.ReadFile(ctx, path)
+}
+
+// Changed lists the bucket and compares keys and ETags with the last Update.
+func (s *S3Source) Changed(ctx context.Context) (bool, error) {
+	if err := s.loadETags(ctx); err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(s.dir.dir); err != nil {
+		return true, nil // stored ETags but no mirror, e.g. the posts dir was removed
+	}
+	objects, err := s.listObjects(ctx)
+	if err != nil {
+		return false, err
+	}
+	if s.etags == nil || len(objects) != len(s.etags) {
+		return true, nil
+	}
+	for rel, obj := range objects {
+		if s.etags[rel] != obj.ETag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadETags reads the stored ETags once, before the first Update or Changed.
+func (s *S3Source) loadETags(ctx context.Context) error {
+	if s.db == nil || s.etags != nil {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT path, etag FROM content_etags WHERE source = ?", s.source)
+	if err != nil {
+		return fmt.Errorf("load etags failed: %w", err)
+	}
+	defer rows.Close()
+	etags := make(map[string]string)
+	for rows.Next() {
+		var path, etag string
+		if err := rows.Scan(&path, &etag); err != nil {
+			return fmt.Errorf("load etags failed: %w", err)
+		}
+		etags[path] = etag
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load etags failed: %w", err)
+	}
+	if len(etags) > 0 {
+		s.etags = etags
+	}
+	return nil
+}
+
+// saveETags replaces the stored ETags of this source with etags.
+func (s *S3Source) saveETags(ctx context.Context, etags map[string]string) error {
+	if s.db == nil {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save etags failed: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM content_etags WHERE source = ?", s.source); err != nil {
+		return fmt.Errorf("save etags failed: %w", err)
+	}
+	for path, etag := range etags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO content_etags (source, path, etag) VALUES (?, ?, ?)", s.source, path, etag); err != nil {
+			return fmt.Errorf("save etags failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save etags failed: %w", err)
+	}
+	return nil
+}
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type s3ListResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// listObjects pages through ListObjectsV2 and returns the objects by relative path.
+func (s *S3Source) listObjects(ctx context.Context) (map[string]s3Object, error) {
+	objects := make(map[string]s3Object)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.cfg.Prefix != "" {
+			query.Set("prefix", s.cfg.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, "", query)
+		if err != nil {
+			return nil, fmt.Errorf("list bucket failed: %w", err)
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list bucket failed: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			rel := strings.TrimPrefix(obj.Key, s.cfg.Prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue // folder placeholders
+			}
+			if !filepath.IsLocal(filepath.FromSlash(rel)) {
+				syncLog.WarnContext(ctx, "s3: skipping object with unsafe key", "key", obj.Key)
+				continue
+			}
+			objects[rel] = obj
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// download writes an object to target through a temp file, keeping its modification time.
+func (s *S3Source) download(ctx context.Context, obj s3Object, target string) error {
+	resp, err := s.do(ctx, obj.Key, nil)
+	if err != nil {
+		return fmt.Errorf("get %s failed: %w", obj.Key, err)
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".s3-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("get %s failed: %w", obj.Key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	if !obj.LastModified.IsZero() {
+		os.Chtimes(target, obj.LastModified, obj.LastModified)
+	}
+	return nil
+}
+
+// do sends a signed GET for key (empty = the bucket itself) and checks the status.
+func (s *S3Source) do(ctx context.Context, key string, query url.Values) (*http.Response, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + s.cfg.Bucket
+	u.RawPath = "/" + s3Escape(s.cfg.Bucket, false)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + s3Escape(key, false)
+	}
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.AccessKey != "" {
+		s.sign(req, time.Now().UTC())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// emptySHA256 is the payload hash of a bodyless request.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers to a bodyless request.
+func (s *S3Source) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + emptySHA256 + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters (and "/" unless escapeSlash
+// is set), as SigV4 canonical requests require.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes query parameters sorted by key, in SigV4 canonical form.
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Content source kinds (config sources[].type / posts.type).
+const (
+	ContentGit     = "git"
+	ContentDir     = "dir"
+	ContentArchive = "archive"
+	ContentS3      = "s3"
+)
+
+// ContentSource supplies the files a SyncService indexes. Kinds that are not a local
+// directory mirror their content into the posts dir on Update, so post assets are served
+// from disk the same way as for a git checkout.
+type ContentSource interface {
+	// Kind names the implementation, e.g. "git" or "s3".
+	Kind() string
+	// Update brings the local copy up to date; it runs at the start of every sync.
+	Update(ctx context.Context) error
+	// List returns the slash-separated paths of all files, relative to the posts dir.
+	List(ctx context.Context) ([]string, error)
+	// ReadFile returns the content of a file returned by List.
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	// Changed polls the origin and reports whether Update would change the content.
+	Changed(ctx context.Context) (bool, error)
+}
+
+// DirSource serves a plain local directory as is.
+type DirSource struct {
+	dir         string
+	fingerprint string // of the files at the last Update
+}
+
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir: dir}
+}
+
+func (d *DirSource) Kind() string { return ContentDir }
+
+// Update records the state of the directory for Changed; the files are used in place.
+func (d *DirSource) Update(ctx context.Context) error {
+	fp, err := dirFingerprint(d.dir)
+	if err != nil {
+		return err
+	}
+	d.fingerprint = fp
+	return nil
+}
+
+func (d *DirSource) List(ctx context.Context) ([]string, error) {
+	return listFiles(d.dir)
+}
+
+func (d *DirSource) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return readLocalFile(d.dir, path)
+}
+
+// Changed reports whether any file was added, removed or modified since the last Update.
+func (d *DirSource) Changed(ctx context.Context) (bool, error) {
+	fp, err := dirFingerprint(d.dir)
+	if err != nil {
+		return false, err
+	}
+	return fp != d.fingerprint, nil
+}
+
+// gitSource is the default source: the posts dir is a clone of remoteURL (cloned on first
+// sync when empty) that prod syncs fetch and hard-reset, honouring pins. Without a .git dir
+// it behaves like a DirSource.
+type gitSource struct {
+	s   *SyncService
+	dir DirSource
+}
+
+func newGitSource(s *SyncService) *gitSource {
+	return &gitSource{s: s, dir: DirSource{dir: s.postsPath}}
+}
+
+func (g *gitSource) Kind() string { return ContentGit }
+
+func (g *gitSource) Update(ctx context.Context) error {
+	s := g.s
+	if err := s.ensurePostsFromRemote(ctx); err != nil {
+		// Keep serving an existing checkout; without one there is nothing to index
+		if _, statErr := os.Stat(s.postsPath); statErr != nil {
+			return err
+		}
+		s.log().WarnContext(ctx, "clone from remote failed, keeping the existing checkout", "error", err)
+	}
+
+	if !s.isDev {
+		if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); err != nil {
+			s.log().WarnContext(ctx, "not a git repo, skipping update", "path", s.postsPath)
+		} else if err := s.gitUpdate(ctx); err != nil {
+			return err
+		}
+	}
+	return g.dir.Update(ctx)
+}
+
+func (g *gitSource) List(ctx context.Context) ([]string, error) {
+	return g.dir.List(ctx)
+}
+
+func (g *gitSource) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return g.dir.ReadFile(ctx, path)
+}
+
+// Changed fetches the tracked branch and compares it with the checkout; in dev, or without
+// a .git dir, it compares the files on disk instead.
+func (g *gitSource) Changed(ctx context.Context) (bool, error) {
+	s := g.s
+	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); s.isDev || err != nil {
+		return g.dir.Changed(ctx)
+	}
+
+	head, err := s.git.Head(ctx, s.postsPath)
+	if err != nil {
+		return false, err
+	}
+	pin, err := s.CurrentPin(ctx)
+	if err != nil {
+		return false, err
+	}
+	if pin != nil {
+		return head.SHA != pin.Commit, nil
+	}
+
+	branch, err := s.trackedBranch(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = s.withGitTimeout(ctx, "fetch", func(ctx context.Context) error {
+		return s.git.Fetch(ctx, s.postsPath, branch)
+	})
+	if err != nil {
+		return false, err
+	}
+	remote, err := s.git.Resolve(ctx, s.postsPath, "origin/"+branch)
+	if err != nil {
+		return false, err
+	}
+	return remote.SHA != head.SHA, nil
+}
+
+// listFiles returns the slash-separated paths of the files under dir, skipping .git.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// readLocalFile reads path (slash-separated, relative to dir), refusing paths outside dir.
+func readLocalFile(dir, path string) ([]byte, error) {
+	local := filepath.FromSlash(path)
+	if !filepath.IsLocal(local) {
+		return nil, fmt.Errorf("invalid content path %q", path)
+	}
+	return os.ReadFile(filepath.Join(dir, local))
+}
+
+// isPostFile reports whether a listed file is a post: Markdown other than a README.
+func isPostFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, ".md") && !strings.EqualFold(base, "README.md")
+}
+
+// dirFingerprint hashes the path, size and mtime of every file under dir.
+func dirFingerprint(dir string) (string, error) {
+	files, err := listFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blog-suiseiseki/database"
+)
+
+func newContentTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func countPosts(t *testing.T, db *database.DB) int {
+	t.Helper()
+	var n int
+	if err := db.Conn().QueryRow("SELECT COUNT(*) FROM posts").Scan(&n); err != nil {
+		t.Fatalf("count posts: %v", err)
+	}
+	return n
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg, ModTime: time.Now()})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestArchiveSource(t *testing.T) {
+	var mu sync.Mutex
+	archive := tarGz(t, map[string]string{
+		"posts/a.md":      "---\ntitle: A\nslug: a\n---\n\nA",
+		"posts/img/x.png": "png",
+		"posts/b/b.md":    "---\ntitle: B\nslug: b\n---\n\nB",
+		"posts/README.md": "not a post",
+	})
+	etag := `"v1"`
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == http.MethodGet {
+			downloads++
+		}
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	db := newContentTestDB(t)
+	postsDir := filepath.Join(t.TempDir(), "posts")
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "")
+	syncService.SetContentSource(NewArchiveSource(srv.URL+"/build/posts.tar.gz?token=x", postsDir))
+
+	ctx := context.Background()
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if n := countPosts(t, db); n != 2 {
+		t.Errorf("want 2 posts, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(postsDir, "img", "x.png")); err != nil {
+		t.Errorf("want assets extracted without the top-level dir: %v", err)
+	}
+
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("sync if changed: %v", err)
+	}
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("want unchanged archive not downloaded again, got %d downloads", downloads)
+	}
+
+	mu.Lock()
+	archive = zipArchive(t, map[string]string{"a.md": "---\ntitle: A2\nslug: a\n---\n\nA2"})
+	etag = `"v2"`
+	mu.Unlock()
+	syncService.SetContentSource(NewArchiveSource(srv.URL+"/build/posts.zip", postsDir))
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync zip: %v", err)
+	}
+	var title string
+	db.Conn().QueryRow("SELECT title FROM posts WHERE slug = 'a'").Scan(&title)
+	if n := countPosts(t, db); n != 1 || title != "A2" {
+		t.Errorf("want only the updated post, got %d posts, title %q", n, title)
+	}
+}
+
+func TestArchiveEntriesStayInsideDest(t *testing.T) {
+	dest := t.TempDir()
+	data := tarGz(t, map[string]string{"../evil.md": "x"})
+	if err := extractTarGz(bytes.NewReader(data), dest); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	// "../evil.md" is cleaned to "evil.md" inside dest, never written outside it
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "evil.md")); !os.IsNotExist(err) {
+		t.Errorf("want no file written outside dest, stat err: %v", err)
+	}
+}
+
+// fakeS3 is a MinIO-style stand-in serving ListObjectsV2 (one key per page) and GetObject
+// for path-style requests to one bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]string
+	gets    int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/"+f.bucket {
+		prefix := r.URL.Query().Get("prefix")
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+		type content struct {
+			Key  string
+			ETag string
+			Size int
+		}
+		var result struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Contents              []content
+			IsTruncated           bool
+			NextContinuationToken string `xml:",omitempty"`
+		}
+		if start < len(keys) {
+			k := keys[start]
+			result.Contents = []content{{Key: k, ETag: fmt.Sprintf(`"%x"`, len(f.objects[k])), Size: len(f.objects[k])}}
+			result.IsTruncated = start+1 < len(keys)
+			if result.IsTruncated {
+				result.NextContinuationToken = strconv.Itoa(start + 1)
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+	content, ok := f.objects[key]
+	if !ok {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	f.gets++
+	w.Write([]byte(content))
+}
+
+func TestS3Source(t *testing.T) {
+	s3 := &fakeS3{bucket: "blog", objects: map[string]string{
+		"site/hello.md":      "---\ntitle: Hello\nslug: hello\n---\n\nHi",
+		"site/notes/a b.md":  "---\ntitle: Spaces\nslug: spaces\n---\n\nSpace",
+		"site/notes/pic.png": "png",
+		"other/ignored.md":   "---\ntitle: Other\n---\n",
+	}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	db := newContentTestDB(t)
+	postsDir := filepath.Join(t.TempDir(), "posts")
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "")
+	newSource := func() *S3Source {
+		source := NewS3Source(S3Config{
+			Endpoint:  srv.URL,
+			Bucket:    "blog",
+			Prefix:    "site",
+			AccessKey: "minio",
+			SecretKey: "minio123",
+		}, postsDir)
+		source.SetETagStore(db.Conn(), "default")
+		return source
+	}
+	syncService.SetContentSource(newSource())
+
+	ctx := context.Background()
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if n := countPosts(t, db); n != 2 {
+		t.Errorf("want 2 posts from the prefix, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(postsDir, "notes", "pic.png")); err != nil {
+		t.Errorf("want asset mirrored: %v", err)
+	}
+
+	gets := s3.gets
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("sync if changed: %v", err)
+	}
+	if s3.gets != gets {
+		t.Errorf("want no downloads for an unchanged bucket, got %d more", s3.gets-gets)
+	}
+
+	// A restart reads the ETags back instead of downloading the bucket again
+	restarted := newSource()
+	if changed, err := restarted.Changed(ctx); err != nil || changed {
+		t.Errorf("want no change reported after a restart, got %v (%v)", changed, err)
+	}
+	syncService.SetContentSource(restarted)
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync after restart: %v", err)
+	}
+	if s3.gets != gets {
+		t.Errorf("want no downloads after a restart, got %d more", s3.gets-gets)
+	}
+
+	s3.mu.Lock()
+	delete(s3.objects, "site/hello.md")
+	s3.mu.Unlock()
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("sync after delete: %v", err)
+	}
+	if n := countPosts(t, db); n != 1 {
+		t.Errorf("want deleted object's post removed, got %d posts", n)
+	}
+	if _, err := os.Stat(filepath.Join(postsDir, "hello.md")); !os.IsNotExist(err) {
+		t.Errorf("want mirrored file removed, stat err: %v", err)
+	}
+}
+
+func TestSyncIfChanged_Dir(t *testing.T) {
+	db := newContentTestDB(t)
+	postsDir := t.TempDir()
+	os.WriteFile(filepath.Join(postsDir, "a.md"), []byte("---\ntitle: A\n---\n\nA"), 0644)
+
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "")
+	syncService.SetContentSource(NewDirSource(postsDir))
+	ctx := context.Background()
+	runs := func() int {
+		n, err := syncService.CountRuns(ctx)
+		if err != nil {
+			t.Fatalf("count runs: %v", err)
+		}
+		return n
+	}
+
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("want an unchanged dir not resynced, got %d runs", n)
+	}
+
+	os.WriteFile(filepath.Join(postsDir, "b.md"), []byte("---\ntitle: B\n---\n\nB"), 0644)
+	if err := syncService.SyncIfChanged(ctx, TriggerInterval); err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	if n := runs(); n != 2 {
+		t.Errorf("want a sync after adding a file, got %d runs", n)
+	}
+}
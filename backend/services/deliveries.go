@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// deliveryRetention is how long webhook delivery IDs are remembered for dedupe.
+const deliveryRetention = 30 * 24 * time.Hour
+
+// DefaultDeliveryTimeout is how long a delivery may stay processing before a redelivery of it
+// is run again, e.g. when the sync hung.
+const DefaultDeliveryTimeout = 15 * time.Minute
+
+// Webhook delivery statuses.
+const (
+	DeliveryProcessing = "processing"
+	DeliveryDone       = "done"
+	DeliveryFailed     = "failed"
+)
+
+// DeliveryLog remembers webhook delivery IDs in SQLite so redelivered events are not re-run.
+type DeliveryLog struct {
+	db        *sql.DB
+	startedAt time.Time // deliveries still processing from before this are orphaned
+	timeout   time.Duration
+}
+
+func NewDeliveryLog(db *sql.DB) *DeliveryLog {
+	return &DeliveryLog{db: db, startedAt: time.Now().UTC(), timeout: DefaultDeliveryTimeout}
+}
+
+// SetTimeout sets how long a delivery may stay processing before it is retried; d <= 0
+// restores the default.
+func (l *DeliveryLog) SetTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultDeliveryTimeout
+	}
+	l.timeout = d
+}
+
+// Begin records a delivery as processing. It returns false when the delivery was already seen,
+// unless its previous attempt failed or never finished: it is still processing but started
+// before this process (which crashed or was killed mid-sync) or longer than the timeout ago.
+func (l *DeliveryLog) Begin(ctx context.Context, id, event string) (bool, error) {
+	now := time.Now().UTC()
+	stale := now.Add(-l.timeout)
+	if l.startedAt.After(stale) {
+		stale = l.startedAt
+	}
+	if _, err := l.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE received_at < ?", now.Add(-deliveryRetention)); err != nil {
+		return false, err
+	}
+
+	res, err := l.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (delivery_id, event, status, received_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(delivery_id) DO UPDATE SET status = excluded.status, received_at = excluded.received_at
+		WHERE webhook_deliveries.status = ?
+			OR (webhook_deliveries.status = ? AND webhook_deliveries.received_at < ?)
+	`, id, event, DeliveryProcessing, now, DeliveryFailed, DeliveryProcessing, stale)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Finish stores the outcome of a delivery.
+func (l *DeliveryLog) Finish(id, status string) error {
+	_, err := l.db.Exec("UPDATE webhook_deliveries SET status = ? WHERE delivery_id = ?", status, id)
+	return err
+}
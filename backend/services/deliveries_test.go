@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeliveryLog(t *testing.T) {
+	db := newContentTestDB(t)
+	ctx := context.Background()
+	begin := func(l *DeliveryLog, id string) bool {
+		t.Helper()
+		fresh, err := l.Begin(ctx, id, "push")
+		if err != nil {
+			t.Fatalf("begin %s: %v", id, err)
+		}
+		return fresh
+	}
+
+	l := NewDeliveryLog(db.Conn())
+	if !begin(l, "done") || !begin(l, "failed") || !begin(l, "stuck") {
+		t.Fatal("want new deliveries to run")
+	}
+	l.Finish("done", DeliveryDone)
+	l.Finish("failed", DeliveryFailed)
+	if begin(l, "done") {
+		t.Error("want a finished delivery acknowledged, not re-run")
+	}
+	if !begin(l, "failed") {
+		t.Error("want a failed delivery retried")
+	}
+	if begin(l, "stuck") {
+		t.Error("want a delivery still processing in this process acknowledged")
+	}
+
+	// After a restart, deliveries left processing by the old process are retried
+	time.Sleep(10 * time.Millisecond)
+	restarted := NewDeliveryLog(db.Conn())
+	if !begin(restarted, "stuck") {
+		t.Error("want a delivery orphaned by a restart retried")
+	}
+	if begin(restarted, "done") {
+		t.Error("want a finished delivery acknowledged after a restart")
+	}
+
+	// A delivery processing longer than the timeout is retried too
+	restarted.SetTimeout(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if !begin(restarted, "stuck") {
+		t.Error("want a delivery processing past the timeout retried")
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around each change, as in git diff.
+const diffContext = 3
+
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// unifiedDiff returns a unified diff turning a into b, or "" when they are equal.
+func unifiedDiff(a, b, nameA, nameB string) string {
+	if a == b {
+		return ""
+	}
+
+	var lines []diffLine
+	for _, d := range diff.Do(a, b) {
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l != "" {
+				lines = append(lines, diffLine{d.Type, l})
+			}
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+
+	// Walk the lines, cutting a hunk wherever more than 2*diffContext equal lines separate changes
+	lineA, lineB := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffmatchpatch.DiffEqual {
+			lineA++
+			lineB++
+			i++
+			continue
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		startA, startB := lineA-(i-start), lineB-(i-start)
+
+		end, equalRun := i, 0
+		for j := i; j < len(lines); j++ {
+			if lines[j].op == diffmatchpatch.DiffEqual {
+				equalRun++
+				if equalRun > 2*diffContext {
+					break
+				}
+			} else {
+				equalRun = 0
+				end = j
+			}
+		}
+		end += diffContext
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+
+		var hunk strings.Builder
+		countA, countB := 0, 0
+		for _, l := range lines[start : end+1] {
+			text := l.text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n\\ No newline at end of file\n"
+			}
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				hunk.WriteString(" " + text)
+				countA++
+				countB++
+			case diffmatchpatch.DiffDelete:
+				hunk.WriteString("-" + text)
+				countA++
+			case diffmatchpatch.DiffInsert:
+				hunk.WriteString("+" + text)
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(startA, countA), hunkRange(startB, countB))
+		out.WriteString(hunk.String())
+
+		// Advance line numbers past the hunk
+		for _, l := range lines[i : end+1] {
+			if l.op != diffmatchpatch.DiffInsert {
+				lineA++
+			}
+			if l.op != diffmatchpatch.DiffDelete {
+				lineB++
+			}
+		}
+		i = end + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk header range; an empty range points at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"blog-suiseiseki/models"
+)
+
+// Event types published on the EventBus.
+const (
+	EventPostCreated   = "post_created"
+	EventPostUpdated   = "post_updated"
+	EventPostDeleted   = "post_deleted"
+	EventSyncCompleted = "sync_completed"
+	EventSyncFailed    = "sync_failed"
+)
+
+// DefaultEventBuffer is how many recent events are kept for replay to reconnecting clients.
+const DefaultEventBuffer = 256
+
+// subscriberBuffer is how many events a subscriber may lag behind before it is dropped.
+const subscriberBuffer = 64
+
+// Event is one published event. IDs increase by one per event, starting at 1 for each process.
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// PostEvent is the data of the post_* events.
+type PostEvent struct {
+	Source   string `json:"source"`
+	Slug     string `json:"slug"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Path     string `json:"path"` // relative to the source's posts dir
+}
+
+// Topics returns the topics an event is published under, for clients that subscribe to a
+// subset (see the WebSocket endpoint): "all", "posts", "slug:<slug>", "category:<category>"
+// and "source:<name>" for post events; "all", "sync" and "source:<name>" for sync events.
+func (e Event) Topics() []string {
+	switch data := e.Data.(type) {
+	case PostEvent:
+		topics := []string{"all", "posts", "slug:" + data.Slug, "source:" + data.Source}
+		if data.Category != "" {
+			topics = append(topics, "category:"+data.Category)
+		}
+		return topics
+	case models.SyncRun:
+		return []string{"all", "sync", "source:" + data.Source}
+	}
+	return []string{"all"}
+}
+
+// SyncEventNotifier receives the events of a SyncService; see EventBus.
+type SyncEventNotifier interface {
+	Publish(eventType string, data interface{}) Event
+}
+
+// EventBus fans published events out to subscribers (e.g. SSE clients) and keeps the most
+// recent ones in a ring buffer, so a client reconnecting with the last ID it saw can replay
+// what it missed.
+type EventBus struct {
+	mu     sync.Mutex
+	ring   []Event
+	lastID uint64
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+func NewEventBus(size int) *EventBus {
+	if size <= 0 {
+		size = DefaultEventBuffer
+	}
+	return &EventBus{
+		ring: make([]Event, size),
+		subs: make(map[*Subscription]bool),
+	}
+}
+
+// Publish assigns the next ID to an event and delivers it without blocking. A subscriber
+// whose buffer is full is dropped: its channel is closed and it has to resubscribe, replaying
+// from the buffer.
+func (b *EventBus) Publish(eventType string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev := Event{ID: b.lastID, Type: eventType, Time: time.Now().UTC(), Data: data}
+	b.ring[(ev.ID-1)%uint64(len(b.ring))] = ev
+
+	// Sends and closes both happen under mu, so nothing is ever sent on a closed channel
+	for sub := range b.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return ev
+}
+
+// Close ends all subscriptions, e.g. so SSE streams finish on shutdown. Later subscriptions
+// get a closed channel; Publish still records events for replay.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Closed reports whether Close was called.
+func (b *EventBus) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// LastID returns the ID of the latest event, 0 before the first.
+func (b *EventBus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Subscription receives the events published after it was created.
+type Subscription struct {
+	// C delivers new events. It is closed when the subscriber fell behind or was closed.
+	C <-chan Event
+	// Replay holds the buffered events after the lastID passed to Subscribe.
+	Replay []Event
+	// Missed is set when events after lastID are no longer buffered (or lastID is from before
+	// a restart), so the client has to refetch its state instead of replaying.
+	Missed bool
+
+	bus *EventBus
+	ch  chan Event
+}
+
+// Subscribe starts a subscription. With lastID > 0 the buffered events after it are replayed.
+func (b *EventBus) Subscribe(lastID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, bus: b, ch: ch}
+	if lastID > 0 {
+		oldest := uint64(1)
+		if size := uint64(len(b.ring)); b.lastID > size {
+			oldest = b.lastID - size + 1
+		}
+		if lastID > b.lastID || lastID+1 < oldest {
+			sub.Missed = true
+		} else {
+			for id := lastID + 1; id <= b.lastID; id++ {
+				sub.Replay = append(sub.Replay, b.ring[(id-1)%uint64(len(b.ring))])
+			}
+		}
+	}
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	b.subs[sub] = true
+	return sub
+}
+
+// Close ends the subscription; it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if s.bus.subs[s] {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
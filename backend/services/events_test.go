@@ -0,0 +1,88 @@
+package services
+
+import "testing"
+
+func TestEventBus_Replay(t *testing.T) {
+	bus := NewEventBus(3)
+	for i := 0; i < 5; i++ {
+		bus.Publish(EventPostUpdated, PostEvent{Slug: "a"})
+	}
+
+	tests := []struct {
+		name       string
+		lastID     uint64
+		wantReplay []uint64
+		wantMissed bool
+	}{
+		{"new client", 0, nil, false},
+		{"up to date", 5, nil, false},
+		{"replays buffered", 2, []uint64{3, 4, 5}, false},
+		{"evicted from buffer", 1, nil, true},
+		{"from before a restart", 9, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := bus.Subscribe(tt.lastID)
+			defer sub.Close()
+			var ids []uint64
+			for _, ev := range sub.Replay {
+				ids = append(ids, ev.ID)
+			}
+			if len(ids) != len(tt.wantReplay) || sub.Missed != tt.wantMissed {
+				t.Fatalf("want replay %v missed %t, got %v missed %t", tt.wantReplay, tt.wantMissed, ids, sub.Missed)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantReplay[i] {
+					t.Errorf("want replay %v, got %v", tt.wantReplay, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBus_SlowSubscriberDropped(t *testing.T) {
+	bus := NewEventBus(0)
+	slow := bus.Subscribe(0)
+	fast := bus.Subscribe(0)
+	defer fast.Close()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.Publish(EventSyncCompleted, nil)
+		<-fast.C
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("want the slow subscriber's channel closed after %d events, got %d", subscriberBuffer, n)
+	}
+	// Closing after being dropped, and twice, must not panic
+	slow.Close()
+	slow.Close()
+
+	ev := bus.Publish(EventSyncCompleted, nil)
+	if got := <-fast.C; got.ID != ev.ID || ev.ID != subscriberBuffer+2 {
+		t.Errorf("want increasing IDs delivered, got %d (published %d)", got.ID, ev.ID)
+	}
+}
+
+func TestEventBus_Close(t *testing.T) {
+	bus := NewEventBus(0)
+	sub := bus.Subscribe(0)
+	bus.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Error("want the subscriber's channel closed")
+	}
+	late := bus.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("want a subscription after Close to start closed")
+	}
+	late.Close()
+	bus.Close()
+	if ev := bus.Publish(EventSyncCompleted, nil); ev.ID != 1 || !bus.Closed() {
+		t.Errorf("want Publish to keep working after Close, got %+v", ev)
+	}
+}
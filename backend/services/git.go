@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Git backends selectable via config sync.git_backend.
+const (
+	GitBackendGoGit = "go-git" // in-process, no git binary needed
+	GitBackendExec  = "exec"   // shells out to the git binary
+)
+
+// Commit is structured information about a git commit.
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// ErrFileNotInRevision is returned by FileAt when the path does not exist at that revision.
+var ErrFileNotInRevision = errors.New("file does not exist in revision")
+
+// FileDates holds the first and last commits that touched a file.
+type FileDates struct {
+	Created  Commit
+	Modified Commit
+}
+
+// GitBackend performs the git operations SyncService needs on the posts repo.
+// Implementations must honour ctx cancellation for network operations.
+type GitBackend interface {
+	Name() string
+	// Clone makes a shallow clone of branch (or the default branch when empty) into dir.
+	Clone(ctx context.Context, url, dir, branch string) error
+	// Fetch updates refs/remotes/origin/<branch> from origin, following force-pushes.
+	Fetch(ctx context.Context, dir, branch string) error
+	// ResetHard moves HEAD and the working tree to ref (a SHA or e.g. "origin/main").
+	ResetHard(ctx context.Context, dir, ref string) (*Commit, error)
+	// Clean removes untracked files and directories (ignored files are kept).
+	Clean(ctx context.Context, dir string) error
+	// Head returns the commit checked out in dir.
+	Head(ctx context.Context, dir string) (*Commit, error)
+	// CurrentBranch returns the branch HEAD points to, or "" when detached.
+	CurrentBranch(ctx context.Context, dir string) (string, error)
+	// DefaultBranch returns the remote's default branch recorded by the clone (origin/HEAD),
+	// or "" when the clone has none.
+	DefaultBranch(ctx context.Context, dir string) (string, error)
+	// Resolve returns the commit rev (a full or abbreviated SHA, branch or tag) names in the local repo.
+	Resolve(ctx context.Context, dir, rev string) (*Commit, error)
+	// Deepen fetches the full history of a shallow clone.
+	Deepen(ctx context.Context, dir string) error
+	// FileDates walks the history of HEAD once and returns, per file path relative to dir
+	// (slash-separated), the first and last commits that changed it. Merge commits are skipped.
+	FileDates(ctx context.Context, dir string) (map[string]FileDates, error)
+	// FileLog returns the commits reachable from HEAD that changed path, newest first.
+	FileLog(ctx context.Context, dir, path string) ([]Commit, error)
+	// FileAt returns the content of path at commit sha, or ErrFileNotInRevision.
+	FileAt(ctx context.Context, dir, sha, path string) ([]byte, error)
+}
+
+// NewGitBackend returns the backend with the given name; "" selects go-git.
+func NewGitBackend(name string) (GitBackend, error) {
+	switch name {
+	case "", GitBackendGoGit:
+		return NewGoGitBackend(), nil
+	case GitBackendExec:
+		return NewExecGitBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown git backend %q (want %s or %s)", name, GitBackendGoGit, GitBackendExec)
+	}
+}
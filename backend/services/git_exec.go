@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// execGitBackend shells out to the git binary; kept as a fallback for setups that rely on
+// git's own credential helpers or SSH config.
+type execGitBackend struct{}
+
+func NewExecGitBackend() GitBackend {
+	return execGitBackend{}
+}
+
+func (execGitBackend) Name() string { return GitBackendExec }
+
+func (execGitBackend) run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+func (b execGitBackend) Clone(ctx context.Context, url, dir, branch string) error {
+	args := []string{"clone", "--depth", "1"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	_, err := b.run(ctx, "", append(args, url, dir)...)
+	return err
+}
+
+func (b execGitBackend) Fetch(ctx context.Context, dir, branch string) error {
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)
+	_, err := b.run(ctx, dir, "fetch", "origin", refspec)
+	return err
+}
+
+func (b execGitBackend) ResetHard(ctx context.Context, dir, ref string) (*Commit, error) {
+	if _, err := b.run(ctx, dir, "reset", "--hard", ref); err != nil {
+		return nil, err
+	}
+	return b.Head(ctx, dir)
+}
+
+func (b execGitBackend) Clean(ctx context.Context, dir string) error {
+	_, err := b.run(ctx, dir, "clean", "-fd")
+	return err
+}
+
+func (b execGitBackend) CurrentBranch(ctx context.Context, dir string) (string, error) {
+	output, err := b.run(ctx, dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return "", nil // detached HEAD
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (b execGitBackend) DefaultBranch(ctx context.Context, dir string) (string, error) {
+	output, err := b.run(ctx, dir, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return "", nil // no origin/HEAD
+	}
+	return strings.TrimPrefix(strings.TrimSpace(output), "origin/"), nil
+}
+
+func (b execGitBackend) Deepen(ctx context.Context, dir string) error {
+	_, err := b.run(ctx, dir, "fetch", "--unshallow", "origin")
+	return err
+}
+
+func (b execGitBackend) FileDates(ctx context.Context, dir string) (map[string]FileDates, error) {
+	// One record per commit: RS, the commit fields and subject, then the changed paths one per line
+	output, err := b.run(ctx, dir, "-c", "core.quotePath=false", "log", "--no-renames", "--name-only",
+		"--format=%x1e%H%x00%an%x00%ae%x00%aI%x00%s")
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]FileDates)
+	for _, record := range strings.Split(output, "\x1e") {
+		header, names, ok := strings.Cut(record, "\n")
+		if !ok {
+			continue
+		}
+		commit, err := parseCommit(header)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(names, "\n") {
+			if name == "" {
+				continue
+			}
+			// git log is newest first: the first sighting is the last modification
+			d, seen := dates[name]
+			if !seen {
+				d.Modified = *commit
+			}
+			d.Created = *commit
+			dates[name] = d
+		}
+	}
+	return dates, nil
+}
+
+func (b execGitBackend) FileLog(ctx context.Context, dir, path string) ([]Commit, error) {
+	output, err := b.run(ctx, dir, "log", "--no-renames", "--format=%x1e"+strings.TrimPrefix(commitFormat, "--format="), "--", path)
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	for _, record := range strings.Split(output, "\x1e") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		commit, err := parseCommit(record)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, *commit)
+	}
+	return commits, nil
+}
+
+func (b execGitBackend) FileAt(ctx context.Context, dir, sha, path string) ([]byte, error) {
+	if strings.HasPrefix(sha, "-") {
+		return nil, fmt.Errorf("invalid revision %q", sha)
+	}
+	listing, err := b.run(ctx, dir, "ls-tree", "--name-only", sha, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(listing) == "" {
+		return nil, ErrFileNotInRevision
+	}
+	output, err := b.run(ctx, dir, "cat-file", "blob", sha+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// commitFormat separates fields with NUL so messages may contain anything but NUL.
+const commitFormat = "--format=%H%x00%an%x00%ae%x00%aI%x00%B"
+
+func (b execGitBackend) Head(ctx context.Context, dir string) (*Commit, error) {
+	output, err := b.run(ctx, dir, "log", "-1", commitFormat)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommit(output)
+}
+
+func (b execGitBackend) Resolve(ctx context.Context, dir, rev string) (*Commit, error) {
+	// rev comes from API callers; never let it be parsed as an option
+	if strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision %q", rev)
+	}
+	output, err := b.run(ctx, dir, "log", "-1", commitFormat, rev+"^{commit}", "--")
+	if err != nil {
+		return nil, err
+	}
+	return parseCommit(output)
+}
+
+func parseCommit(record string) (*Commit, error) {
+	fields := strings.SplitN(record, "\x00", 5)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("unexpected git log output: %q", record)
+	}
+	date, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("parse commit date: %w", err)
+	}
+	return &Commit{
+		SHA:     fields[0],
+		Author:  fields[1],
+		Email:   fields[2],
+		Date:    date,
+		Message: strings.TrimSpace(fields[4]),
+	}, nil
+}
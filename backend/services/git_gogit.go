@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// goGitBackend runs git in-process with go-git, so the host needs no git binary.
+type goGitBackend struct{}
+
+func NewGoGitBackend() GitBackend {
+	return goGitBackend{}
+}
+
+func (goGitBackend) Name() string { return GitBackendGoGit }
+
+func (goGitBackend) Clone(ctx context.Context, url, dir, branch string) error {
+	opts := &git.CloneOptions{
+		URL:   url,
+		Depth: 1,
+	}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		opts.SingleBranch = true
+	}
+	repo, err := git.PlainCloneContext(ctx, dir, false, opts)
+	if err != nil {
+		return fmt.Errorf("git clone failed: %w", err)
+	}
+	if branch != "" {
+		return nil
+	}
+	// Record the remote's default branch as origin/HEAD, like git clone does
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil || !head.Target().IsBranch() {
+		return nil
+	}
+	originHead := plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName("origin"),
+		plumbing.NewRemoteReferenceName("origin", head.Target().Short()))
+	if err := repo.Storer.SetReference(originHead); err != nil {
+		return fmt.Errorf("write origin/HEAD failed: %w", err)
+	}
+	return nil
+}
+
+func (goGitBackend) Fetch(ctx context.Context, dir, branch string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("open repo failed: %w", err)
+	}
+	refspec := config.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch))
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{refspec},
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+	return nil
+}
+
+func (b goGitBackend) ResetHard(ctx context.Context, dir, ref string) (*Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s failed: %w", ref, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: *hash, Mode: git.HardReset}); err != nil {
+		return nil, fmt.Errorf("git reset failed: %w", err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return toCommit(commit), nil
+}
+
+func (goGitBackend) Clean(ctx context.Context, dir string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("open repo failed: %w", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("git clean failed: %w", err)
+	}
+	return nil
+}
+
+func (goGitBackend) CurrentBranch(ctx context.Context, dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", fmt.Errorf("open repo failed: %w", err)
+	}
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return "", err
+	}
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", nil
+	}
+	return head.Target().Short(), nil
+}
+
+func (goGitBackend) DefaultBranch(ctx context.Context, dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", fmt.Errorf("open repo failed: %w", err)
+	}
+	ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if ref.Type() != plumbing.SymbolicReference || !ref.Target().IsRemote() {
+		return "", nil
+	}
+	return strings.TrimPrefix(ref.Target().Short(), "origin/"), nil
+}
+
+func (goGitBackend) Head(ctx context.Context, dir string) (*Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return toCommit(commit), nil
+}
+
+func (goGitBackend) Resolve(ctx context.Context, dir, rev string) (*Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s failed: %w", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return toCommit(commit), nil
+}
+
+func (goGitBackend) Deepen(ctx context.Context, dir string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("open repo failed: %w", err)
+	}
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		Depth:      math.MaxInt32,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+	// go-git fetches the missing history but leaves .git/shallow in place
+	return repo.Storer.SetShallow(nil)
+}
+
+func (goGitBackend) FileDates(ctx context.Context, dir string) (map[string]FileDates, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	dates := make(map[string]FileDates)
+	err = iter.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.NumParents() > 1 {
+			return nil
+		}
+		names, err := changedFiles(c)
+		if err != nil {
+			return err
+		}
+		commit := toCommit(c)
+		// Log is newest first: the first sighting is the last modification
+		for _, name := range names {
+			d, seen := dates[name]
+			if !seen {
+				d.Modified = *commit
+			}
+			d.Created = *commit
+			dates[name] = d
+		}
+		return nil
+	})
+	// The parents of a shallow clone's oldest commit are missing; stop there
+	if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, err
+	}
+	return dates, nil
+}
+
+func (goGitBackend) FileLog(ctx context.Context, dir, path string) ([]Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash(), FileName: &path})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	commits := []Commit{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		commits = append(commits, *toCommit(c))
+		return nil
+	})
+	if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, err
+	}
+	return commits, nil
+}
+
+func (goGitBackend) FileAt(ctx context.Context, dir, sha, path string) ([]byte, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open repo failed: %w", err)
+	}
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, ErrFileNotInRevision
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// changedFiles lists the paths c changed relative to its first parent (all paths for a root commit).
+func changedFiles(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() == 1 {
+		parent, err := c.Parent(0)
+		switch {
+		case errors.Is(err, plumbing.ErrObjectNotFound):
+			// shallow boundary: treat as a root commit
+		case err != nil:
+			return nil, err
+		default:
+			if parentTree, err = parent.Tree(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func toCommit(c *object.Commit) *Commit {
+	return &Commit{
+		SHA:     c.Hash.String(),
+		Author:  c.Author.Name,
+		Email:   c.Author.Email,
+		Date:    c.Author.When,
+		Message: strings.TrimSpace(c.Message),
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRemote creates a git repo with one commit on main to act as origin.
+func newTestRemote(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "remote")
+	os.MkdirAll(dir, 0755)
+	gitCmd(t, dir, "init", "-b", "main")
+	commitFile(t, dir, "hello.md", "---\ntitle: Hello\n---\n\nHello", "Add hello")
+	return dir
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test Author", "GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Test Author", "GIT_COMMITTER_EMAIL=author@example.com",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+}
+
+func commitFile(t *testing.T, dir, name, content, message string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-m", message)
+}
+
+func TestGitBackends(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	for _, name := range []string{GitBackendGoGit, GitBackendExec} {
+		t.Run(name, func(t *testing.T) {
+			backend, err := NewGitBackend(name)
+			if err != nil {
+				t.Fatalf("new backend: %v", err)
+			}
+			ctx := context.Background()
+			remote := newTestRemote(t)
+			dir := filepath.Join(t.TempDir(), "posts")
+
+			if err := backend.Clone(ctx, "file://"+remote, dir, ""); err != nil {
+				t.Fatalf("clone: %v", err)
+			}
+			head, err := backend.Head(ctx, dir)
+			if err != nil {
+				t.Fatalf("head: %v", err)
+			}
+			if head.Message != "Add hello" || head.Author != "Test Author" || len(head.SHA) != 40 {
+				t.Errorf("unexpected head commit: %+v", head)
+			}
+			if branch, err := backend.CurrentBranch(ctx, dir); err != nil || branch != "main" {
+				t.Errorf("want current branch main, got %q (%v)", branch, err)
+			}
+			if branch, err := backend.DefaultBranch(ctx, dir); err != nil || branch != "main" {
+				t.Errorf("want default branch main from origin/HEAD, got %q (%v)", branch, err)
+			}
+
+			if resolved, err := backend.Resolve(ctx, dir, head.SHA[:10]); err != nil || resolved.SHA != head.SHA {
+				t.Errorf("want short SHA resolved to %s, got %+v (%v)", head.SHA, resolved, err)
+			}
+			if _, err := backend.Resolve(ctx, dir, "no-such-rev"); err == nil {
+				t.Error("want error resolving unknown revision")
+			}
+
+			commitFile(t, remote, "second.md", "# Second", "Add second")
+
+			if err := backend.Fetch(ctx, dir, "main"); err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			reset, err := backend.ResetHard(ctx, dir, "origin/main")
+			if err != nil {
+				t.Fatalf("reset: %v", err)
+			}
+			if reset.Message != "Add second" {
+				t.Errorf("want reset to new commit, got %+v", reset)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "second.md")); err != nil {
+				t.Errorf("want second.md in working tree: %v", err)
+			}
+
+			dates, err := backend.FileDates(ctx, dir)
+			if err != nil {
+				t.Fatalf("file dates: %v", err)
+			}
+			if d := dates["second.md"]; d.Created.Message != "Add second" || d.Modified.SHA != reset.SHA {
+				t.Errorf("unexpected dates for second.md: %+v", d)
+			}
+
+			log, err := backend.FileLog(ctx, dir, "hello.md")
+			if err != nil || len(log) != 1 || log[0].SHA != head.SHA {
+				t.Errorf("want hello.md log [%s], got %+v (%v)", head.SHA, log, err)
+			}
+			if content, err := backend.FileAt(ctx, dir, reset.SHA, "second.md"); err != nil || string(content) != "# Second" {
+				t.Errorf("want second.md content at new commit, got %q (%v)", content, err)
+			}
+			if _, err := backend.FileAt(ctx, dir, head.SHA, "second.md"); err != ErrFileNotInRevision {
+				t.Errorf("want ErrFileNotInRevision before second.md existed, got %v", err)
+			}
+
+			stray := filepath.Join(dir, "stray.md")
+			os.WriteFile(stray, []byte("# Stray"), 0644)
+			if err := backend.Clean(ctx, dir); err != nil {
+				t.Fatalf("clean: %v", err)
+			}
+			if _, err := os.Stat(stray); !os.IsNotExist(err) {
+				t.Errorf("want untracked file removed, stat err: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNoHistory is returned when the posts dir is not a git repo.
+var ErrNoHistory = errors.New("posts dir is not a git repo")
+
+// ErrNoRevision is returned when a revision asked for does not name a commit, or the file has
+// no commits at all.
+var ErrNoRevision = errors.New("no such revision")
+
+// FileDiff is the change to one post file between two revisions.
+type FileDiff struct {
+	Path string  `json:"path"`
+	From *Commit `json:"from"`
+	To   *Commit `json:"to"`
+	Diff string  `json:"diff"` // unified diff of the Markdown source; empty when unchanged
+}
+
+// historyCache holds file logs read at one HEAD; it is emptied when HEAD moves, so repeated
+// history and diff requests do not walk the history again.
+type historyCache struct {
+	mu     sync.Mutex
+	commit string
+	logs   map[string][]Commit // by path
+}
+
+func (c *historyCache) get(commit, path string) ([]Commit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if commit != c.commit {
+		return nil, false
+	}
+	commits, ok := c.logs[path]
+	return commits, ok
+}
+
+func (c *historyCache) put(commit, path string, commits []Commit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if commit != c.commit {
+		c.commit, c.logs = commit, make(map[string][]Commit)
+	}
+	c.logs[path] = commits
+}
+
+// FileHistory lists the commits that changed the post file at contentPath, newest first.
+func (s *SyncService) FileHistory(ctx context.Context, contentPath string) ([]Commit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkRepo(); err != nil {
+		return nil, err
+	}
+	return s.fileLog(ctx, s.relPath(contentPath))
+}
+
+// fileLog returns the commits that changed path, from the cache while HEAD has not moved.
+// Call with s.mu held.
+func (s *SyncService) fileLog(ctx context.Context, path string) ([]Commit, error) {
+	head := s.headCommit(ctx)
+	if commits, ok := s.history.get(head, path); ok && head != "" {
+		return commits, nil
+	}
+	var commits []Commit
+	err := s.withGitTimeout(ctx, "log", func(ctx context.Context) error {
+		var err error
+		commits, err = s.git.FileLog(ctx, s.postsPath, path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if head != "" {
+		s.history.put(head, path, commits)
+	}
+	return commits, nil
+}
+
+// FileDiff diffs the post file at contentPath between revisions from and to. An empty to means
+// the file's latest commit and an empty from its first commit, i.e. the changes since first publication.
+func (s *SyncService) FileDiff(ctx context.Context, contentPath, from, to string) (*FileDiff, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkRepo(); err != nil {
+		return nil, err
+	}
+	path := s.relPath(contentPath)
+
+	if from == "" || to == "" {
+		history, err := s.fileLog(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) == 0 {
+			return nil, fmt.Errorf("%w: %s has no commits", ErrNoRevision, path)
+		}
+		if to == "" {
+			to = history[0].SHA
+		}
+		if from == "" {
+			from = history[len(history)-1].SHA
+		}
+	}
+
+	var d *FileDiff
+	err := s.withGitTimeout(ctx, "diff", func(ctx context.Context) error {
+		fromCommit, err := s.resolve(ctx, from)
+		if err != nil {
+			return err
+		}
+		toCommit, err := s.resolve(ctx, to)
+		if err != nil {
+			return err
+		}
+
+		before, err := s.fileAt(ctx, fromCommit.SHA, path)
+		if err != nil {
+			return err
+		}
+		after, err := s.fileAt(ctx, toCommit.SHA, path)
+		if err != nil {
+			return err
+		}
+
+		d = &FileDiff{
+			Path: path,
+			From: fromCommit,
+			To:   toCommit,
+			Diff: unifiedDiff(before, after, "a/"+path, "b/"+path),
+		}
+		return nil
+	})
+	return d, err
+}
+
+// resolve looks up rev; a failure other than a timeout or cancellation means there is no such commit.
+func (s *SyncService) resolve(ctx context.Context, rev string) (*Commit, error) {
+	commit, err := s.git.Resolve(ctx, s.postsPath, rev)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoRevision, rev)
+	}
+	return commit, err
+}
+
+// fileAt returns path at sha, or "" when the file does not exist there yet (or any more).
+func (s *SyncService) fileAt(ctx context.Context, sha, path string) (string, error) {
+	content, err := s.git.FileAt(ctx, s.postsPath, sha, path)
+	if errors.Is(err, ErrFileNotInRevision) {
+		return "", nil
+	}
+	return string(content), err
+}
+
+func (s *SyncService) checkRepo() error {
+	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); err != nil {
+		return ErrNoHistory
+	}
+	return nil
+}
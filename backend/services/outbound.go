@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blog-suiseiseki/logging"
+	"blog-suiseiseki/models"
+)
+
+// Outbound delivery statuses.
+const (
+	OutboundPending   = "pending"
+	OutboundDelivered = "delivered"
+	OutboundFailed    = "failed" // gave up after the last attempt
+)
+
+const (
+	// DefaultOutboundAttempts is how often a delivery is tried before it is given up.
+	DefaultOutboundAttempts = 6
+	// DefaultOutboundBackoff is the wait before the first retry; it doubles with each retry.
+	DefaultOutboundBackoff = 10 * time.Second
+
+	outboundTimeout   = 10 * time.Second
+	outboundRetention = 30 * 24 * time.Hour
+	outboundBatch     = 50
+)
+
+var errUnknownWebhook = errors.New("webhook no longer configured")
+
+// DefaultOutboundEvents are sent to webhooks that do not list their events.
+var DefaultOutboundEvents = []string{EventPostCreated, EventPostUpdated, EventPostDeleted, EventSyncFailed}
+
+// OutboundWebhook is a URL notified of events, e.g. a chat bot or a CI trigger.
+type OutboundWebhook struct {
+	URL    string
+	Secret string   // signs the body: X-Blog-Signature-256: sha256=<hex HMAC-SHA256>
+	Events []string // event types to send; empty = DefaultOutboundEvents
+}
+
+func (w OutboundWebhook) wants(eventType string) bool {
+	events := w.Events
+	if len(events) == 0 {
+		events = DefaultOutboundEvents
+	}
+	for _, e := range events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Outbound POSTs bus events as JSON to the configured webhooks. Every delivery is recorded in
+// outbound_deliveries before it is sent, so failed deliveries are retried with exponential
+// backoff, across restarts too, until they succeed or run out of attempts.
+type Outbound struct {
+	db       *sql.DB
+	bus      *EventBus
+	sub      *Subscription
+	hooks    []OutboundWebhook
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// NewOutbound subscribes to bus right away, so events published before Run are queued too.
+func NewOutbound(db *sql.DB, bus *EventBus, hooks []OutboundWebhook) *Outbound {
+	return &Outbound{
+		db:       db,
+		bus:      bus,
+		sub:      bus.Subscribe(0),
+		hooks:    hooks,
+		client:   &http.Client{Timeout: outboundTimeout},
+		attempts: DefaultOutboundAttempts,
+		backoff:  DefaultOutboundBackoff,
+	}
+}
+
+// SetRetry sets the number of attempts per delivery and the first retry delay; values <= 0
+// keep the defaults.
+func (o *Outbound) SetRetry(attempts int, backoff time.Duration) {
+	if attempts > 0 {
+		o.attempts = attempts
+	}
+	if backoff > 0 {
+		o.backoff = backoff
+	}
+}
+
+// Run queues the events the webhooks want and sends due deliveries until ctx is done.
+func (o *Outbound) Run(ctx context.Context) {
+	sub := o.sub
+	defer func() { sub.Close() }()
+	events := sub.C
+	var lastID uint64
+
+	timer := time.NewTimer(0) // deliveries left pending by a previous run are due now
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				if o.bus.Closed() {
+					events = nil // shutting down: keep sending what is queued until ctx is done
+					continue
+				}
+				// Dropped while sending: resubscribe and queue what was missed
+				sub = o.bus.Subscribe(lastID)
+				events = sub.C
+				if sub.Missed {
+					outboundLog.Warn("events were lost while sending", "after", lastID)
+				}
+				for _, ev := range sub.Replay {
+					lastID = ev.ID
+					o.enqueue(ev)
+				}
+				continue
+			}
+			lastID = ev.ID
+			if o.enqueue(ev) {
+				resetTimer(timer, 0)
+			}
+		case <-timer.C:
+			timer.Reset(o.sendDue(ctx))
+		}
+	}
+}
+
+var outboundLog = logging.New("outbound")
+
+// enqueue records a pending delivery per webhook that wants ev and reports whether there was one.
+func (o *Outbound) enqueue(ev Event) bool {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		outboundLog.Error("encode event failed", "event_id", ev.ID, "error", err)
+		return false
+	}
+	now := time.Now().UTC()
+	queued := false
+	for _, hook := range o.hooks {
+		if !hook.wants(ev.Type) {
+			continue
+		}
+		_, err := o.db.Exec(`
+			INSERT INTO outbound_deliveries (url, event_id, event_type, payload, status, created_at, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, hook.URL, ev.ID, ev.Type, string(payload), OutboundPending, now, now)
+		if err != nil {
+			outboundLog.Error("record delivery failed", "error", err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		if _, err := o.db.Exec("DELETE FROM outbound_deliveries WHERE status != ? AND created_at < ?", OutboundPending, now.Add(-outboundRetention)); err != nil {
+			outboundLog.Error("prune deliveries failed", "error", err)
+		}
+	}
+	return queued
+}
+
+// sendDue attempts the deliveries that are due and returns how long until the next one is.
+func (o *Outbound) sendDue(ctx context.Context) time.Duration {
+	type due struct {
+		id       int64
+		url      string
+		event    string
+		payload  string
+		attempts int
+	}
+	rows, err := o.db.QueryContext(ctx, `
+		SELECT id, url, event_type, payload, attempts FROM outbound_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?
+	`, OutboundPending, time.Now().UTC(), outboundBatch)
+	if err != nil {
+		outboundLog.ErrorContext(ctx, "read deliveries failed", "error", err)
+		return o.backoff
+	}
+	var batch []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.url, &d.event, &d.payload, &d.attempts); err != nil {
+			rows.Close()
+			outboundLog.ErrorContext(ctx, "read deliveries failed", "error", err)
+			return o.backoff
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	for _, d := range batch {
+		if ctx.Err() != nil {
+			return 0
+		}
+		attempts := d.attempts + 1
+		code, err := o.post(ctx, d.id, d.url, d.event, []byte(d.payload))
+		if err == errUnknownWebhook {
+			attempts = o.attempts // removed from the config: no point retrying
+		}
+		if err := o.record(d.id, d.url, d.event, attempts, code, err); err != nil {
+			outboundLog.ErrorContext(ctx, "record delivery failed", "delivery", d.id, "error", err)
+		}
+	}
+	if len(batch) == outboundBatch {
+		return 0
+	}
+
+	var next time.Time
+	err = o.db.QueryRowContext(ctx, `
+		SELECT next_attempt_at FROM outbound_deliveries
+		WHERE status = ? ORDER BY next_attempt_at LIMIT 1
+	`, OutboundPending).Scan(&next)
+	if err == sql.ErrNoRows {
+		return time.Hour // woken by the next event
+	}
+	if err != nil {
+		outboundLog.ErrorContext(ctx, "read deliveries failed", "error", err)
+		return o.backoff
+	}
+	if d := time.Until(next); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// post sends one delivery and returns the response status.
+func (o *Outbound) post(ctx context.Context, id int64, url, event string, payload []byte) (int, error) {
+	var hook *OutboundWebhook
+	for i := range o.hooks {
+		if o.hooks[i].URL == url {
+			hook = &o.hooks[i]
+			break
+		}
+	}
+	if hook == nil {
+		return 0, errUnknownWebhook
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blog-suiseiseki-webhook")
+	req.Header.Set("X-Blog-Event", event)
+	req.Header.Set("X-Blog-Delivery", strconv.FormatInt(id, 10))
+	if hook.Secret != "" {
+		req.Header.Set("X-Blog-Signature-256", SignOutbound(hook.Secret, payload))
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of an attempt and schedules the retry, if any.
+func (o *Outbound) record(id int64, url, event string, attempts, code int, sendErr error) error {
+	now := time.Now().UTC()
+	if sendErr == nil {
+		_, err := o.db.Exec(`
+			UPDATE outbound_deliveries SET status = ?, attempts = ?, response_code = ?, error = '',
+				next_attempt_at = NULL, delivered_at = ?
+			WHERE id = ?
+		`, OutboundDelivered, attempts, code, now, id)
+		return err
+	}
+
+	if attempts >= o.attempts {
+		outboundLog.Error("delivery failed, giving up", "delivery", id, "event", event, "url", url, "attempts", attempts, "error", sendErr)
+		_, err := o.db.Exec(`
+			UPDATE outbound_deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = NULL
+			WHERE id = ?
+		`, OutboundFailed, attempts, code, sendErr.Error(), id)
+		return err
+	}
+	delay := o.backoff << (attempts - 1)
+	outboundLog.Warn("delivery failed, retrying", "delivery", id, "event", event, "url", url, "attempt", attempts, "retry_in", delay, "error", sendErr)
+	_, err := o.db.Exec(`
+		UPDATE outbound_deliveries SET attempts = ?, response_code = ?, error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, attempts, code, sendErr.Error(), now.Add(delay), id)
+	return err
+}
+
+// SignOutbound returns the X-Blog-Signature-256 header value for body.
+func SignOutbound(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ListDeliveries returns recorded deliveries newest first.
+func (o *Outbound) ListDeliveries(ctx context.Context, limit, offset int) ([]models.OutboundDelivery, error) {
+	rows, err := o.db.QueryContext(ctx, `
+		SELECT id, url, event_id, event_type, status, attempts, response_code, error, created_at, next_attempt_at, delivered_at
+		FROM outbound_deliveries ORDER BY id DESC LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.OutboundDelivery{}
+	for rows.Next() {
+		var d models.OutboundDelivery
+		var nextAttempt, delivered sql.NullTime
+		err := rows.Scan(&d.ID, &d.URL, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.Error, &d.CreatedAt, &nextAttempt, &delivered)
+		if err != nil {
+			return nil, err
+		}
+		if nextAttempt.Valid {
+			d.NextAttemptAt = &nextAttempt.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CountDeliveries returns the number of recorded deliveries.
+func (o *Outbound) CountDeliveries(ctx context.Context) (int, error) {
+	var n int
+	err := o.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM outbound_deliveries").Scan(&n)
+	return n, err
+}
+
+// resetTimer stops t, drains it if it fired, and resets it to d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"blog-suiseiseki/models"
+)
+
+// receiver is a webhook endpoint failing the first `fail` requests with 500.
+type receiver struct {
+	mu       sync.Mutex
+	fail     int
+	requests []receivedHook
+}
+
+type receivedHook struct {
+	event     string
+	signature string
+	body      []byte
+	status    int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := http.StatusOK
+	if len(r.requests) < r.fail {
+		status = http.StatusInternalServerError
+	}
+	r.requests = append(r.requests, receivedHook{req.Header.Get("X-Blog-Event"), req.Header.Get("X-Blog-Signature-256"), body, status})
+	w.WriteHeader(status)
+}
+
+func (r *receiver) Requests() []receivedHook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedHook(nil), r.requests...)
+}
+
+// startOutbound runs o until the test ends and returns a func waiting until no delivery is pending.
+func startOutbound(t *testing.T, o *Outbound) func() []models.OutboundDelivery {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return func() []models.OutboundDelivery {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			deliveries, err := o.ListDeliveries(context.Background(), 100, 0)
+			if err != nil {
+				t.Fatalf("list deliveries: %v", err)
+			}
+			pending := len(deliveries) == 0
+			for _, d := range deliveries {
+				pending = pending || d.Status == OutboundPending
+			}
+			if !pending {
+				return deliveries
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("deliveries still pending: %+v", deliveries)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestOutbound_SignedAndRetried(t *testing.T) {
+	db := newContentTestDB(t)
+	recv := &receiver{fail: 1}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	bus := NewEventBus(0)
+	outbound := NewOutbound(db.Conn(), bus, []OutboundWebhook{{URL: srv.URL, Secret: "s3cret"}})
+	outbound.SetRetry(3, 20*time.Millisecond)
+	wait := startOutbound(t, outbound)
+
+	bus.Publish(EventPostCreated, PostEvent{Source: "default", Slug: "hello", Title: "Hello"})
+	bus.Publish(EventSyncCompleted, models.SyncRun{Source: "default"}) // not in the default events
+	bus.Publish(EventSyncFailed, models.SyncRun{Source: "default", Error: "boom"})
+	deliveries := wait()
+
+	if len(deliveries) != 2 {
+		t.Fatalf("want 2 deliveries, got %+v", deliveries)
+	}
+	// Newest first: sync_failed went through at once, post_created after one retry
+	tests := []struct {
+		event    string
+		attempts int
+	}{
+		{EventSyncFailed, 1},
+		{EventPostCreated, 2},
+	}
+	for i, tt := range tests {
+		d := deliveries[i]
+		if d.EventType != tt.event || d.Status != OutboundDelivered || d.Attempts != tt.attempts || d.ResponseCode != 200 || d.DeliveredAt == nil {
+			t.Errorf("delivery %d: want %s delivered after %d attempts, got %+v", i, tt.event, tt.attempts, d)
+		}
+	}
+
+	requests := recv.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("want 3 requests, got %d", len(requests))
+	}
+	for _, r := range requests {
+		if r.signature != SignOutbound("s3cret", r.body) {
+			t.Errorf("%s: signature %q does not match the body", r.event, r.signature)
+		}
+		var ev Event
+		if err := json.Unmarshal(r.body, &ev); err != nil || ev.Type != r.event {
+			t.Errorf("want an event of type %s, got %s (%v)", r.event, r.body, err)
+		}
+	}
+	if requests[0].event != EventPostCreated || requests[0].status != 500 {
+		t.Errorf("want the first post_created request failed, got %s (%d)", requests[0].event, requests[0].status)
+	}
+}
+
+func TestOutbound_GivesUp(t *testing.T) {
+	db := newContentTestDB(t)
+	recv := &receiver{fail: 100}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	bus := NewEventBus(0)
+	outbound := NewOutbound(db.Conn(), bus, []OutboundWebhook{{URL: srv.URL, Events: []string{EventPostDeleted}}})
+	outbound.SetRetry(3, 10*time.Millisecond)
+	wait := startOutbound(t, outbound)
+
+	bus.Publish(EventPostCreated, PostEvent{Slug: "a"}) // filtered out
+	bus.Publish(EventPostDeleted, PostEvent{Slug: "b"})
+	deliveries := wait()
+
+	if len(deliveries) != 1 {
+		t.Fatalf("want 1 delivery, got %+v", deliveries)
+	}
+	d := deliveries[0]
+	if d.EventType != EventPostDeleted || d.Status != OutboundFailed || d.Attempts != 3 || d.ResponseCode != 500 || d.Error == "" {
+		t.Errorf("want post_deleted failed after 3 attempts, got %+v", d)
+	}
+	requests := recv.Requests()
+	if len(requests) != 3 || requests[0].signature != "" {
+		t.Errorf("want 3 unsigned requests, got %+v", requests)
+	}
+}
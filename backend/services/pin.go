@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"blog-suiseiseki/models"
+)
+
+// DefaultRollbackDepth is how many recently synced commits can be rolled back to.
+const DefaultRollbackDepth = 10
+
+// ErrNotRollbackTarget is returned when a rollback names a commit outside the recent sync history.
+var ErrNotRollbackTarget = errors.New("commit is not one of the recently synced commits")
+
+// ErrPinInDev is returned by Pin and Rollback in dev mode, where syncs never reset the posts
+// dir (it is edited in place), so a pin would be reported but not applied.
+var ErrPinInDev = errors.New("pin and rollback are not available in dev mode: the posts dir is edited in place, not reset")
+
+// SetRollbackDepth sets how many recently synced commits Rollback accepts; n <= 0 restores the default.
+func (s *SyncService) SetRollbackDepth(n int) {
+	if n <= 0 {
+		n = DefaultRollbackDepth
+	}
+	s.rollbackDepth = n
+}
+
+// Pin holds the posts repo at rev (empty = the commit currently checked out) until Unpin.
+// The pin is stored in the database, so it survives restarts and can be set from the CLI
+// while the server runs; it takes effect on the next sync. In dev mode it returns ErrPinInDev.
+func (s *SyncService) Pin(ctx context.Context, rev, reason string) (*models.Pin, error) {
+	if s.isDev {
+		return nil, ErrPinInDev
+	}
+	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); err != nil {
+		return nil, fmt.Errorf("posts dir is not a git repo: %s", s.postsPath)
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+	commit, err := s.git.Resolve(ctx, s.postsPath, rev)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s not found in posts repo: %w", rev, err)
+	}
+
+	pin := &models.Pin{
+		Commit:   commit.SHA,
+		Message:  commit.Message,
+		Reason:   reason,
+		PinnedAt: time.Now().UTC(),
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO content_pins (source, commit_sha, message, reason, pinned_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(source) DO UPDATE SET
+			commit_sha = excluded.commit_sha,
+			message = excluded.message,
+			reason = excluded.reason,
+			pinned_at = excluded.pinned_at
+	`, s.source, pin.Commit, pin.Message, pin.Reason, pin.PinnedAt)
+	if err != nil {
+		return nil, fmt.Errorf("save pin failed: %w", err)
+	}
+	return pin, nil
+}
+
+// Unpin lets syncs follow the remote branch again. It reports whether a pin was removed.
+func (s *SyncService) Unpin(ctx context.Context) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM content_pins WHERE source = ?", s.source)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CurrentPin returns the active pin, or nil when syncs follow the remote branch.
+func (s *SyncService) CurrentPin(ctx context.Context) (*models.Pin, error) {
+	var pin models.Pin
+	err := s.db.QueryRowContext(ctx, "SELECT commit_sha, message, reason, pinned_at FROM content_pins WHERE source = ?", s.source).
+		Scan(&pin.Commit, &pin.Message, &pin.Reason, &pin.PinnedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// SyncedCommits returns the distinct commits served by the last successful syncs, newest first,
+// limited to the rollback depth.
+func (s *SyncService) SyncedCommits(ctx context.Context) ([]models.SyncedCommit, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT commit_after, id, started_at FROM sync_runs
+		WHERE id IN (
+			SELECT MAX(id) FROM sync_runs
+			WHERE source = ? AND status = ? AND commit_after != ''
+			GROUP BY commit_after
+		)
+		ORDER BY id DESC
+		LIMIT ?
+	`, s.source, RunOK, s.rollbackDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commits := []models.SyncedCommit{}
+	for rows.Next() {
+		var c models.SyncedCommit
+		if err := rows.Scan(&c.Commit, &c.RunID, &c.SyncedAt); err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+	}
+	return commits, rows.Err()
+}
+
+// Rollback pins the site to commit, which must be one of the recently synced commits
+// (a unique SHA prefix is enough). Callers run a sync afterwards to reindex.
+func (s *SyncService) Rollback(ctx context.Context, commit, reason string) (*models.Pin, error) {
+	commits, err := s.SyncedCommits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var target string
+	for _, c := range commits {
+		if len(commit) >= 7 && len(commit) <= len(c.Commit) && c.Commit[:len(commit)] == commit {
+			if target != "" && target != c.Commit {
+				return nil, fmt.Errorf("commit prefix %s is ambiguous", commit)
+			}
+			target = c.Commit
+		}
+	}
+	if target == "" {
+		return nil, ErrNotRollbackTarget
+	}
+	return s.Pin(ctx, target, reason)
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"blog-suiseiseki/database"
+	"blog-suiseiseki/logging"
+)
+
+// DefaultPreviewMax is how many previews are kept when no limit is configured.
+const DefaultPreviewMax = 10
+
+// Preview is a non-default branch of the posts repo, cloned and indexed on its own so it can be
+// browsed before merge. Each preview has its own posts dir and SQLite DB under the previews dir.
+type Preview struct {
+	Branch    string
+	Key       string // URL- and filename-safe form of Branch, see PreviewKey
+	PostsPath string
+	DB        *database.DB
+	Sync      *SyncService
+
+	lastUsed time.Time      // guarded by PreviewManager.mu; the least recently used is evicted
+	inflight sync.WaitGroup // requests and syncs using DB; it is closed once they are done
+}
+
+// PreviewKey encodes a branch for URLs and directory names. Git forbids "~" in ref names,
+// so replacing "/" with "~" is reversible.
+func PreviewKey(branch string) string {
+	return strings.ReplaceAll(branch, "/", "~")
+}
+
+// PreviewBranch reverses PreviewKey.
+func PreviewBranch(key string) string {
+	return strings.ReplaceAll(key, "~", "/")
+}
+
+// checkPreviewBranch rejects branch names that do not map to a directory of their own.
+func checkPreviewBranch(branch string) error {
+	if branch == "" || strings.HasPrefix(branch, ".") || strings.Contains(branch, "..") {
+		return fmt.Errorf("invalid preview branch %q", branch)
+	}
+	return nil
+}
+
+var previewLog = logging.New("preview")
+
+// PreviewManager creates, updates and drops branch previews.
+type PreviewManager struct {
+	dir        string
+	remoteURL  string
+	git        GitBackend
+	gitTimeout time.Duration
+	max        int
+
+	mu       sync.Mutex
+	previews map[string]*Preview // by key
+}
+
+func NewPreviewManager(dir, remoteURL string, git GitBackend, gitTimeout time.Duration) *PreviewManager {
+	return &PreviewManager{
+		dir:        dir,
+		remoteURL:  remoteURL,
+		git:        git,
+		gitTimeout: gitTimeout,
+		max:        DefaultPreviewMax,
+		previews:   make(map[string]*Preview),
+	}
+}
+
+// SetMax limits how many previews are kept, each a full clone: creating one more drops the
+// least recently pushed or viewed. n <= 0 restores the default.
+func (m *PreviewManager) SetMax(n int) {
+	if n <= 0 {
+		n = DefaultPreviewMax
+	}
+	m.max = n
+}
+
+// Load reopens previews left on disk by a previous run.
+func (m *PreviewManager) Load() error {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p, err := m.open(PreviewBranch(e.Name()))
+		if err != nil {
+			previewLog.Error("reopen preview failed", "preview", e.Name(), "error", err)
+			continue
+		}
+		p.inflight.Done()
+	}
+	m.evict(m.max)
+	return nil
+}
+
+// Update fetches branch into its preview (creating it on first push) and reindexes it.
+func (m *PreviewManager) Update(ctx context.Context, branch string) (*Preview, error) {
+	m.mu.Lock()
+	_, exists := m.previews[PreviewKey(branch)]
+	m.mu.Unlock()
+	if !exists {
+		m.evict(m.max - 1)
+	}
+	p, err := m.open(branch)
+	if err != nil {
+		return nil, err
+	}
+	defer p.inflight.Done()
+	m.mu.Lock()
+	p.lastUsed = time.Now()
+	m.mu.Unlock()
+	if err := p.Sync.Sync(ctx, TriggerWebhook); err != nil {
+		return p, fmt.Errorf("preview %s sync failed: %w", branch, err)
+	}
+	return p, nil
+}
+
+// open returns the preview for branch, opening its DB on first use; the caller calls
+// p.inflight.Done when it no longer uses it.
+func (m *PreviewManager) open(branch string) (*Preview, error) {
+	if err := checkPreviewBranch(branch); err != nil {
+		return nil, err
+	}
+	key := PreviewKey(branch)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.previews[key]; ok {
+		p.inflight.Add(1)
+		return p, nil
+	}
+
+	root := filepath.Join(m.dir, key)
+	dbPath := filepath.Join(root, "blog.db")
+	var lastUsed time.Time // a preview left on disk was last used at its last sync
+	if info, err := os.Stat(dbPath); err == nil {
+		lastUsed = info.ModTime()
+	}
+	db, err := database.New(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open preview db failed: %w", err)
+	}
+	postsPath := filepath.Join(root, "posts")
+	syncService := NewSyncService(db.Conn(), postsPath, false, nil, m.remoteURL)
+	syncService.SetGitBackend(m.git)
+	syncService.SetGitTimeout(m.gitTimeout)
+	syncService.SetBranch(branch)
+
+	p := &Preview{
+		Branch:    branch,
+		Key:       key,
+		PostsPath: postsPath,
+		DB:        db,
+		Sync:      syncService,
+		lastUsed:  lastUsed,
+	}
+	p.inflight.Add(1)
+	m.previews[key] = p
+	return p, nil
+}
+
+// Acquire returns the preview with the given key, or nil. Its DB stays open until release is
+// called, even when the preview is removed meanwhile.
+func (m *PreviewManager) Acquire(key string) (p *Preview, release func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p = m.previews[key]
+	if p == nil {
+		return nil, func() {}
+	}
+	p.inflight.Add(1)
+	p.lastUsed = time.Now()
+	return p, p.inflight.Done
+}
+
+// List returns all previews ordered by branch.
+func (m *PreviewManager) List() []*Preview {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*Preview, 0, len(m.previews))
+	for _, p := range m.previews {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Branch < list[j].Branch })
+	return list
+}
+
+// Remove drops the preview for branch and deletes its files; a missing preview is not an error.
+func (m *PreviewManager) Remove(branch string) error {
+	// The key names a directory under m.dir; an empty or dotted one would be m.dir or outside it
+	if err := checkPreviewBranch(branch); err != nil {
+		return err
+	}
+	key := PreviewKey(branch)
+
+	m.mu.Lock()
+	p, ok := m.previews[key]
+	delete(m.previews, key)
+	m.mu.Unlock()
+
+	if !ok {
+		if err := os.RemoveAll(filepath.Join(m.dir, key)); err != nil {
+			return fmt.Errorf("remove preview %s failed: %w", branch, err)
+		}
+		return nil
+	}
+	if err := m.drop(p); err != nil {
+		return err
+	}
+	previewLog.Info("preview removed", "branch", branch)
+	return nil
+}
+
+// evict drops the least recently used previews until at most n are left.
+func (m *PreviewManager) evict(n int) {
+	m.mu.Lock()
+	var victims []*Preview
+	for len(m.previews) > n {
+		var lru *Preview
+		for _, p := range m.previews {
+			if lru == nil || p.lastUsed.Before(lru.lastUsed) {
+				lru = p
+			}
+		}
+		delete(m.previews, lru.Key)
+		victims = append(victims, lru)
+	}
+	m.mu.Unlock()
+
+	for _, p := range victims {
+		previewLog.Info("preview limit reached, dropping the least recently used", "branch", p.Branch, "max", m.max)
+		if err := m.drop(p); err != nil {
+			previewLog.Error("drop preview failed", "branch", p.Branch, "error", err)
+		}
+	}
+}
+
+// drop waits until no request or sync uses p, which is no longer in m.previews, then closes
+// its DB and deletes its files.
+func (m *PreviewManager) drop(p *Preview) error {
+	p.inflight.Wait()
+	p.DB.Close()
+	if err := os.RemoveAll(filepath.Join(m.dir, p.Key)); err != nil {
+		return fmt.Errorf("remove preview %s failed: %w", p.Branch, err)
+	}
+	return nil
+}
+
+// Close waits for preview requests and syncs and closes their DBs.
+func (m *PreviewManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.previews {
+		p.inflight.Wait()
+		p.DB.Close()
+	}
+}
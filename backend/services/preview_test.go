@@ -0,0 +1,88 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviewManager_RemoveWaitsForRequests(t *testing.T) {
+	m := NewPreviewManager(t.TempDir(), "", NewGoGitBackend(), time.Minute)
+	defer m.Close()
+	p, err := m.open("feature/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.inflight.Done()
+
+	got, release := m.Acquire(p.Key)
+	if got != p {
+		t.Fatalf("want preview %s, got %v", p.Key, got)
+	}
+	removed := make(chan error)
+	go func() { removed <- m.Remove("feature/a") }()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := p.DB.Conn().Ping(); err != nil {
+		t.Fatalf("want the DB open while a request uses it: %v", err)
+	}
+	if again, _ := m.Acquire(p.Key); again != nil {
+		t.Error("want a removed preview gone for new requests")
+	}
+	release()
+	if err := <-removed; err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.dir, p.Key)); !os.IsNotExist(err) {
+		t.Errorf("want preview files deleted, got %v", err)
+	}
+}
+
+func TestPreviewManager_RemoveRejectsBadBranch(t *testing.T) {
+	dir := t.TempDir()
+	m := NewPreviewManager(dir, "", NewGoGitBackend(), time.Minute)
+	defer m.Close()
+	p, err := m.open("feature/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.inflight.Done()
+
+	for _, branch := range []string{"", ".", "..", "../feature~a"} {
+		if err := m.Remove(branch); err == nil {
+			t.Errorf("Remove(%q): want an error", branch)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, p.Key)); err != nil {
+		t.Errorf("want the previews dir left alone, got %v", err)
+	}
+}
+
+func TestPreviewManager_Evict(t *testing.T) {
+	m := NewPreviewManager(t.TempDir(), "", NewGoGitBackend(), time.Minute)
+	defer m.Close()
+	m.SetMax(2)
+	for _, branch := range []string{"a", "b"} {
+		p, err := m.open(branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.inflight.Done()
+	}
+	_, release := m.Acquire("a") // b is now the least recently used
+	release()
+
+	m.evict(m.max - 1)
+	if p, _ := m.Acquire("b"); p != nil {
+		t.Error("want the least recently used preview b evicted")
+	}
+	if _, err := os.Stat(filepath.Join(m.dir, "b")); !os.IsNotExist(err) {
+		t.Errorf("want b's files deleted, got %v", err)
+	}
+	if p, release := m.Acquire("a"); p == nil {
+		t.Error("want a kept")
+	} else {
+		release()
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Scheduler syncs the sources whose content changed every interval (sync.interval_minutes).
+// The interval can change while it runs, e.g. on config reload; 0 pauses it.
+type Scheduler struct {
+	sources  *Sources
+	interval time.Duration
+	updates  chan time.Duration
+}
+
+func NewScheduler(sources *Sources, interval time.Duration) *Scheduler {
+	return &Scheduler{sources: sources, interval: interval, updates: make(chan time.Duration, 1)}
+}
+
+// SetInterval changes the interval; the next sync is one new interval from now.
+func (s *Scheduler) SetInterval(d time.Duration) {
+	select {
+	case <-s.updates: // replace an update Run has not picked up yet
+	default:
+	}
+	s.updates <- d
+}
+
+// Run starts no sync after stop is closed; the syncs use ctx, so a running one can finish.
+func (s *Scheduler) Run(ctx context.Context, stop <-chan struct{}) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	set := func(d time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if d > 0 {
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+			syncLog.Info("periodic sync scheduled", "interval", d)
+		}
+	}
+	set(s.interval)
+	defer set(0)
+
+	for {
+		select {
+		case d := <-s.updates:
+			if d <= 0 {
+				syncLog.Info("periodic sync disabled")
+			}
+			set(d)
+		case <-tick:
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := s.sources.SyncChanged(ctx, TriggerInterval); err != nil {
+				syncLog.ErrorContext(ctx, "periodic sync failed", "error", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
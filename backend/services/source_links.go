@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Hosting providers with built-in source link templates (config source_links.provider).
+const (
+	SourceGitHub    = "github"
+	SourceGitLab    = "gitlab"
+	SourceGitea     = "gitea" // also Forgejo and Codeberg
+	SourceBitbucket = "bitbucket"
+)
+
+// Template placeholders: {repo} is the repository web URL, {branch} the served branch and
+// {path} the file path relative to the posts dir.
+var sourceTemplates = map[string][2]string{
+	SourceGitHub:    {"{repo}/blob/{branch}/{path}", "{repo}/commits/{branch}/{path}"},
+	SourceGitLab:    {"{repo}/-/blob/{branch}/{path}", "{repo}/-/commits/{branch}/{path}"},
+	SourceGitea:     {"{repo}/src/branch/{branch}/{path}", "{repo}/commits/branch/{branch}/{path}"},
+	SourceBitbucket: {"{repo}/src/{branch}/{path}", "{repo}/history-node/{branch}/{path}"},
+}
+
+// SourceLinks builds "edit this page" and "view history" URLs for post files.
+type SourceLinks struct {
+	repo            string
+	branch          string
+	sourceTemplate  string
+	historyTemplate string
+	defaultBranch   *branchResolver // resolves a blank branch; nil = link to HEAD
+}
+
+// branchResolver looks up the default branch once it is known (e.g. after the first clone).
+type branchResolver struct {
+	mu      sync.Mutex
+	resolve func() (string, error)
+	branch  string
+}
+
+func (r *branchResolver) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.branch == "" {
+		if branch, err := r.resolve(); err == nil {
+			r.branch = branch
+		}
+	}
+	return r.branch
+}
+
+// NewSourceLinks derives link templates from the posts remote URL. provider selects the built-in
+// templates (empty = detect from the host name); non-empty templates override them. An empty
+// branch links to HEAD, which GitHub, GitLab and Bitbucket resolve to the default branch but
+// Gitea does not; see SetBranchResolver. It returns nil, nil when there is nothing to link to.
+func NewSourceLinks(remoteURL, branch, provider, sourceTemplate, historyTemplate string) (*SourceLinks, error) {
+	repo := repoWebURL(remoteURL)
+	if provider == "" && repo != "" {
+		provider = detectSourceProvider(repo)
+	}
+	if provider != "" {
+		defaults, ok := sourceTemplates[strings.ToLower(provider)]
+		if !ok {
+			return nil, fmt.Errorf("unknown source link provider %q", provider)
+		}
+		if sourceTemplate == "" {
+			sourceTemplate = defaults[0]
+		}
+		if historyTemplate == "" {
+			historyTemplate = defaults[1]
+		}
+	}
+	if sourceTemplate == "" && historyTemplate == "" {
+		return nil, nil
+	}
+	if repo == "" && (strings.Contains(sourceTemplate, "{repo}") || strings.Contains(historyTemplate, "{repo}")) {
+		return nil, fmt.Errorf("source link templates use {repo} but posts.remote_url is not set")
+	}
+	return &SourceLinks{
+		repo:            repo,
+		branch:          branch,
+		sourceTemplate:  sourceTemplate,
+		historyTemplate: historyTemplate,
+	}, nil
+}
+
+// SetBranchResolver makes links with a blank branch use the branch resolve returns (e.g. the
+// clone's origin/HEAD). Until it succeeds, templates that use {branch} produce no link.
+func (l *SourceLinks) SetBranchResolver(resolve func() (string, error)) {
+	l.defaultBranch = &branchResolver{resolve: resolve}
+}
+
+// ForBranch returns links for another branch of the same repo (e.g. a preview).
+func (l *SourceLinks) ForBranch(branch string) *SourceLinks {
+	c := *l
+	c.branch = branch
+	c.defaultBranch = nil
+	return &c
+}
+
+// Source returns the URL of the file at relPath (slash-separated) on the hosting provider.
+func (l *SourceLinks) Source(relPath string) string {
+	return l.expand(l.sourceTemplate, relPath)
+}
+
+// History returns the URL of the commit history of the file at relPath.
+func (l *SourceLinks) History(relPath string) string {
+	return l.expand(l.historyTemplate, relPath)
+}
+
+func (l *SourceLinks) expand(template, relPath string) string {
+	if template == "" {
+		return ""
+	}
+	branch := l.branch
+	if branch == "" && strings.Contains(template, "{branch}") {
+		if l.defaultBranch == nil {
+			branch = "HEAD"
+		} else if branch = l.defaultBranch.get(); branch == "" {
+			return ""
+		}
+	}
+	return strings.NewReplacer(
+		"{repo}", l.repo,
+		"{branch}", escapePath(branch),
+		"{path}", escapePath(relPath),
+	).Replace(template)
+}
+
+// escapePath escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// repoWebURL turns a clone URL (https, ssh or scp-like git@host:org/repo.git) into the
+// repository's https web URL; it returns "" for local paths and file:// URLs.
+func repoWebURL(remoteURL string) string {
+	remoteURL = strings.TrimSpace(remoteURL)
+	if remoteURL == "" {
+		return ""
+	}
+
+	var host, repoPath string
+	if u, err := url.Parse(remoteURL); err == nil && u.Host != "" {
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ssh" && u.Scheme != "git" {
+			return ""
+		}
+		host, repoPath = u.Hostname(), u.Path
+		if u.Scheme == "http" || u.Scheme == "https" {
+			host = u.Host // keep a non-default port for web URLs
+		}
+	} else if at := strings.Index(remoteURL, "@"); at >= 0 && strings.Contains(remoteURL[at:], ":") {
+		// scp-like syntax: user@host:org/repo.git
+		hostAndPath := remoteURL[at+1:]
+		host, repoPath, _ = strings.Cut(hostAndPath, ":")
+	} else {
+		return ""
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if host == "" || repoPath == "" {
+		return ""
+	}
+	return "https://" + host + "/" + repoPath
+}
+
+// detectSourceProvider guesses the provider from the repository host; "" when unknown.
+func detectSourceProvider(repo string) string {
+	host := repo
+	if u, err := url.Parse(repo); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	switch {
+	case strings.Contains(host, "github"):
+		return SourceGitHub
+	case strings.Contains(host, "gitlab"):
+		return SourceGitLab
+	case strings.Contains(host, "bitbucket"):
+		return SourceBitbucket
+	case strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"), host == "codeberg.org":
+		return SourceGitea
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sources is the set of content sources merged into one blog, each synced by its own
+// SyncService into the shared posts table. The first source is the primary one: it serves
+// the legacy single-source routes (e.g. /api/webhook) and branch previews.
+type Sources struct {
+	list []*SyncService
+}
+
+func NewSources(list ...*SyncService) *Sources {
+	return &Sources{list: list}
+}
+
+// Primary returns the first source.
+func (s *Sources) Primary() *SyncService {
+	return s.list[0]
+}
+
+// Get returns the source with the given name, or nil.
+func (s *Sources) Get(name string) *SyncService {
+	for _, src := range s.list {
+		if src.source == name {
+			return src
+		}
+	}
+	return nil
+}
+
+// All returns the sources in configuration order.
+func (s *Sources) All() []*SyncService {
+	return s.list
+}
+
+// Names returns the source names in configuration order.
+func (s *Sources) Names() []string {
+	names := make([]string, len(s.list))
+	for i, src := range s.list {
+		names[i] = src.source
+	}
+	return names
+}
+
+// SyncAll syncs every source in turn. A failing source does not stop the others; their
+// errors are joined.
+func (s *Sources) SyncAll(ctx context.Context, trigger string) error {
+	return s.each(ctx, func(src *SyncService) error { return src.Sync(ctx, trigger) })
+}
+
+// SyncChanged syncs the sources whose content changed, see SyncService.SyncIfChanged.
+func (s *Sources) SyncChanged(ctx context.Context, trigger string) error {
+	return s.each(ctx, func(src *SyncService) error { return src.SyncIfChanged(ctx, trigger) })
+}
+
+func (s *Sources) each(ctx context.Context, fn func(*SyncService) error) error {
+	var errs []error
+	for _, src := range s.list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(src); err != nil {
+			errs = append(errs, fmt.Errorf("source %s: %w", src.source, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch starts a Watcher for every source read from a local directory (git or dir); mirrored
+// archive and S3 sources only change on sync. The watchers stop when ctx is done.
+func (s *Sources) Watch(ctx context.Context, debounce time.Duration) {
+	for _, src := range s.list {
+		if kind := src.content.Kind(); kind != ContentGit && kind != ContentDir {
+			continue
+		}
+		w := NewWatcher(src, debounce)
+		go func() {
+			if err := w.Run(ctx); err != nil {
+				watchLog.Error("watch failed", "source", w.s.source, "error", err)
+			}
+		}()
+	}
+}
+
+// Running reports whether any source is syncing.
+func (s *Sources) Running() bool {
+	for _, src := range s.list {
+		if src.Running() {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until in-flight syncs of all sources have finished.
+func (s *Sources) Wait() {
+	for _, src := range s.list {
+		src.Wait()
+	}
+}
+
+// Prune deletes the posts, pins and stored ETags of sources no longer configured, e.g. after the single
+// posts dir was replaced by a sources list. Their slugs would otherwise block the new sources.
+func (s *Sources) Prune(ctx context.Context) error {
+	db := s.Primary().db
+	names := s.Names()
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+
+	res, err := db.ExecContext(ctx, "DELETE FROM posts WHERE source NOT IN ("+placeholders+")", args...)
+	if err != nil {
+		return fmt.Errorf("prune posts failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		syncLog.InfoContext(ctx, "removed posts of sources no longer configured", "posts", n)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM content_pins WHERE source NOT IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("prune pins failed: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM content_etags WHERE source NOT IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("prune etags failed: %w", err)
+	}
+	return nil
+}
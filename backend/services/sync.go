@@ -1,43 +1,155 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"blog-suiseiseki/logging"
+	"blog-suiseiseki/models"
 	"blog-suiseiseki/utils"
 )
 
-// SyncEventNotifier notifies the frontend (e.g. via SSE) when sync completes so the list can refresh.
-type SyncEventNotifier interface {
-	Broadcast()
-}
+var syncLog = logging.New("sync")
+
+// DefaultSource names the content source of a SyncService that was not given one.
+const DefaultSource = "default"
+
+// DefaultGitTimeout bounds a single git subprocess when no timeout is configured.
+const DefaultGitTimeout = 2 * time.Minute
+
+// deepenRetryInterval is how long a failed deepen of a shallow clone waits to be retried.
+const deepenRetryInterval = time.Hour
 
 type SyncService struct {
-	db          *sql.DB
-	postsPath   string
-	remoteURL   string
-	isDev       bool
-	notifier    SyncEventNotifier
+	db         *sql.DB
+	postsPath  string
+	remoteURL  string
+	isDev      bool
+	notifier   SyncEventNotifier
+	git        GitBackend
+	gitTimeout time.Duration
+	content    ContentSource
+
+	source          string // content source the posts dir belongs to, see SetSource
+	slugPrefix      string
+	defaultCategory string
+
+	branch         string // remote branch to track; empty = branch checked out by the clone
+	cleanUntracked bool
+	rollbackDepth  int
+
+	// mu serializes syncs so webhook, ticker and startup runs never interleave DB writes.
+	// Readers of the posts repo (history, diffs) hold it shared, so they never see a
+	// half-reset tree.
+	mu      sync.RWMutex
+	running atomic.Bool
+
+	history historyCache
+
+	// Per-file commit dates at datesCommit, guarded by mu: read again only when HEAD moves.
+	datesCommit   string
+	dates         map[string]FileDates
+	deepenRetryAt time.Time // a failed deepen is not retried before
 }
 
 func NewSyncService(db *sql.DB, postsPath string, isDev bool, notifier SyncEventNotifier, remoteURL string) *SyncService {
-	return &SyncService{
-		db:        db,
-		postsPath: postsPath,
-		remoteURL: remoteURL,
-		isDev:     isDev,
-		notifier:  notifier,
+	s := &SyncService{
+		db:            db,
+		source:        DefaultSource,
+		postsPath:     postsPath,
+		remoteURL:     remoteURL,
+		isDev:         isDev,
+		notifier:      notifier,
+		git:           NewGoGitBackend(),
+		gitTimeout:    DefaultGitTimeout,
+		rollbackDepth: DefaultRollbackDepth,
+	}
+	s.content = newGitSource(s)
+	return s
+}
+
+// SetContentSource replaces the default git source, e.g. with an archive or S3 mirror of the
+// posts dir. Pins, rollback, revision history and git dates only apply to the git source.
+func (s *SyncService) SetContentSource(c ContentSource) {
+	s.content = c
+}
+
+// SetSource names the content source this service syncs. Posts and sync runs are recorded
+// under it, and a sync only adds, updates or deletes posts of its own source.
+func (s *SyncService) SetSource(name string) {
+	s.source = name
+}
+
+// SetPostDefaults sets a prefix for every slug from this source and the category used when
+// front-matter has none.
+func (s *SyncService) SetPostDefaults(slugPrefix, category string) {
+	s.slugPrefix = slugPrefix
+	s.defaultCategory = category
+}
+
+// Source returns the content source name.
+func (s *SyncService) Source() string {
+	return s.source
+}
+
+// PostsPath returns the posts dir of the source.
+func (s *SyncService) PostsPath() string {
+	return s.postsPath
+}
+
+// SetGitBackend replaces the default in-process go-git backend.
+func (s *SyncService) SetGitBackend(b GitBackend) {
+	s.git = b
+}
+
+// SetGitTimeout sets the timeout applied to each git subprocess; d <= 0 restores the default.
+func (s *SyncService) SetGitTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultGitTimeout
+	}
+	s.gitTimeout = d
+}
+
+// SetBranch sets the remote branch the posts dir is reset to on each sync.
+func (s *SyncService) SetBranch(branch string) {
+	s.branch = branch
+}
+
+// SetCleanUntracked makes each sync delete untracked files left in the posts dir.
+func (s *SyncService) SetCleanUntracked(clean bool) {
+	s.cleanUntracked = clean
+}
+
+// Wait blocks until the in-flight sync, if any, has finished.
+func (s *SyncService) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+}
+
+// withGitTimeout runs a git operation under the configured timeout.
+func (s *SyncService) withGitTimeout(ctx context.Context, op string, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.gitTimeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("git %s timed out after %s: %w", op, s.gitTimeout, context.DeadlineExceeded)
 	}
+	return err
 }
 
 // ensurePostsFromRemote clones the remote repo when posts dir is empty or missing.
-func (s *SyncService) ensurePostsFromRemote() error {
+func (s *SyncService) ensurePostsFromRemote(ctx context.Context) error {
 	if s.remoteURL == "" {
 		return nil
 	}
@@ -48,8 +160,9 @@ func (s *SyncService) ensurePostsFromRemote() error {
 		if err := os.MkdirAll(parent, 0755); err != nil {
 			return fmt.Errorf("failed to create dir: %w", err)
 		}
-		log.Printf("posts dir missing, cloning from remote: %s", s.remoteURL)
-		if err := s.gitClone(s.remoteURL, s.postsPath); err != nil {
+		s.log().InfoContext(ctx, "posts dir missing, cloning from remote", "remote", s.remoteURL)
+		if err := s.gitClone(ctx, s.remoteURL, s.postsPath); err != nil {
+			os.RemoveAll(s.postsPath)
 			return err
 		}
 		return nil
@@ -70,12 +183,12 @@ func (s *SyncService) ensurePostsFromRemote() error {
 	}
 
 	// posts empty and not a git repo: clone to temp dir then replace
-	log.Printf("posts empty and not a git repo, cloning from remote: %s", s.remoteURL)
+	s.log().InfoContext(ctx, "posts dir empty and not a git repo, cloning from remote", "remote", s.remoteURL)
 	tmpDir, err := os.MkdirTemp(filepath.Dir(s.postsPath), "posts-clone-*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp dir: %w", err)
 	}
-	if err := s.gitClone(s.remoteURL, tmpDir); err != nil {
+	if err := s.gitClone(ctx, s.remoteURL, tmpDir); err != nil {
 		os.RemoveAll(tmpDir)
 		return err
 	}
@@ -90,132 +203,527 @@ func (s *SyncService) ensurePostsFromRemote() error {
 	return nil
 }
 
-func (s *SyncService) gitClone(url, dest string) error {
-	cmd := exec.Command("git", "clone", "--depth", "1", url, dest)
-	output, err := cmd.CombinedOutput()
+func (s *SyncService) gitClone(ctx context.Context, url, dest string) error {
+	err := s.withGitTimeout(ctx, "clone", func(ctx context.Context) error {
+		return s.git.Clone(ctx, url, dest, s.branch)
+	})
 	if err != nil {
-		return fmt.Errorf("git clone failed: %v, output: %s", err, string(output))
+		return err
 	}
-	log.Printf("git clone ok: %s", string(output))
+	s.log().InfoContext(ctx, "git clone ok", "git", s.git.Name(), "dest", dest)
 	return nil
 }
 
-// Sync: ensure posts from remote if needed, scan .md, update DB; prod runs git pull first
-func (s *SyncService) Sync() error {
-	log.Println("sync: starting...")
+// Sync: ensure posts from remote if needed, scan .md, update DB; prod first fetches and
+// hard-resets the posts dir to the tracked remote branch.
+// DB changes are applied in a single transaction, so a sync cancelled through ctx
+// (e.g. on shutdown) leaves the previous index untouched. Every call is recorded in sync_runs.
+func (s *SyncService) Sync(ctx context.Context, trigger string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running.Store(true)
+	defer s.running.Store(false)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	if err := s.ensurePostsFromRemote(); err != nil {
-		log.Printf("ensurePostsFromRemote failed: %v", err)
+	run := &models.SyncRun{
+		Trigger:      trigger,
+		Status:       RunRunning,
+		StartedAt:    time.Now().UTC(),
+		CommitBefore: s.headCommit(ctx),
+	}
+	if err := s.startRun(run); err != nil {
+		s.log().ErrorContext(ctx, "record run failed", "error", err)
 	}
 
-	if !s.isDev {
-		if err := s.gitPull(); err != nil {
-			log.Printf("git pull failed: %v", err)
+	err := s.sync(ctx, run)
+
+	run.FinishedAt = finishTime()
+	run.CommitAfter = s.headCommit(context.Background())
+	switch {
+	case err == nil:
+		run.Status = RunOK
+	case ctx.Err() != nil:
+		run.Status = RunCancelled
+		run.Error = err.Error()
+	default:
+		run.Status = RunFailed
+		run.Error = err.Error()
+	}
+	syncDuration.Observe(run.FinishedAt.Sub(run.StartedAt).Seconds(), s.source)
+	syncRuns.Inc(s.source, trigger, run.Status)
+	if run.ID != 0 {
+		if err := s.finishRun(run); err != nil {
+			s.log().ErrorContext(ctx, "record run failed", "run", run.ID, "error", err)
 		}
 	}
+	if run.Status == RunFailed {
+		s.log().ErrorContext(ctx, "sync failed", "run", run.ID, "trigger", trigger, "error", err)
+	}
+	switch run.Status {
+	case RunOK:
+		s.publish(EventSyncCompleted, RedactRun(run))
+	case RunFailed:
+		s.publish(EventSyncFailed, RedactRun(run)) // the error stays in the log and the admin API
+	}
+	return err
+}
 
-	files, err := s.scanMarkdownFiles()
+// SyncIfChanged polls the content source and syncs only when it changed. It syncs anyway
+// when the poll fails or the previous run did not succeed.
+func (s *SyncService) SyncIfChanged(ctx context.Context, trigger string) error {
+	if run, err := s.LatestRun(ctx); err != nil || run == nil || run.Status != RunOK {
+		return s.Sync(ctx, trigger)
+	}
+	s.mu.Lock()
+	changed, err := s.content.Changed(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		s.log().WarnContext(ctx, "poll failed, syncing anyway", "error", err)
+	} else if !changed {
+		return nil
+	}
+	return s.Sync(ctx, trigger)
+}
+
+func (s *SyncService) sync(ctx context.Context, run *models.SyncRun) error {
+	s.log().InfoContext(ctx, "sync started", "run", run.ID, "trigger", run.Trigger)
+
+	if err := s.content.Update(ctx); err != nil {
+		return fmt.Errorf("%s update failed: %w", s.content.Kind(), err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		s.log().InfoContext(ctx, "sync cancelled", "run", run.ID, "error", err)
+		return err
+	}
+
+	files, err := s.listPosts(ctx)
 	if err != nil {
 		return fmt.Errorf("scan files failed: %w", err)
 	}
 
-	log.Printf("sync: found %d markdown file(s)", len(files))
+	s.log().DebugContext(ctx, "found markdown files", "run", run.ID, "files", len(files))
+
+	dates := s.fileDates(ctx)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer tx.Rollback()
 
-	existingPaths, err := s.getExistingPaths()
+	existingPaths, err := s.getExistingPaths(tx)
 	if err != nil {
 		return fmt.Errorf("get existing paths failed: %w", err)
 	}
 
+	var changes []PostChange
 	processedPaths := make(map[string]bool)
 	for _, filePath := range files {
+		if err := ctx.Err(); err != nil {
+			s.log().InfoContext(ctx, "sync cancelled, rolling back", "run", run.ID, "error", err)
+			return err
+		}
 		processedPaths[filePath] = true
-		if err := s.processFile(filePath); err != nil {
-			log.Printf("process file %s failed: %v", filePath, err)
+		post, change, err := s.processFile(ctx, tx, filePath, dates)
+		if err != nil {
+			s.log().WarnContext(ctx, "process file failed", "run", run.ID, "file", filePath, "error", err)
+			fileErr := s.fileError(filePath, err)
+			run.FileErrors = append(run.FileErrors, fileErr)
+			if err := s.markStale(tx, filePath, fileErr); err != nil {
+				s.log().ErrorContext(ctx, "mark post stale failed", "run", run.ID, "file", filePath, "error", err)
+			}
+			continue
+		}
+		switch change {
+		case changeAdded:
+			run.Added++
+			changes = append(changes, PostChange{Type: EventPostCreated, PostEvent: post})
+		case changeUpdated:
+			run.Updated++
+			changes = append(changes, PostChange{Type: EventPostUpdated, PostEvent: post})
 		}
 	}
 
-	for path := range existingPaths {
+	for path, post := range existingPaths {
 		if !processedPaths[path] {
-			if err := s.deletePost(path); err != nil {
-				log.Printf("delete post %s failed: %v", path, err)
+			n, err := s.deletePost(tx, path)
+			if err != nil {
+				s.log().ErrorContext(ctx, "delete post failed", "run", run.ID, "file", path, "error", err)
+				continue
+			}
+			if n == 0 {
+				continue // renamed: processFile moved the post to its new path
 			}
+			run.Deleted++
+			changes = append(changes, PostChange{Type: EventPostDeleted, PostEvent: post})
 		}
 	}
 
-	log.Println("sync: done")
-	if s.notifier != nil {
-		s.notifier.Broadcast()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
 	}
+
+	s.log().InfoContext(ctx, "sync done", "run", run.ID, "added", run.Added, "updated", run.Updated, "deleted", run.Deleted, "errors", len(run.FileErrors))
+	s.publishChanges(changes)
 	return nil
 }
 
-func (s *SyncService) gitPull() error {
-	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); os.IsNotExist(err) {
-		return fmt.Errorf("not a git repo: %s", s.postsPath)
+// PostChange is a post created, updated or deleted by a sync or Reindex.
+type PostChange struct {
+	Type string // EventPostCreated, EventPostUpdated or EventPostDeleted
+	PostEvent
+}
+
+// publishChanges announces committed post changes on the event bus.
+func (s *SyncService) publishChanges(changes []PostChange) {
+	for _, c := range changes {
+		s.publish(c.Type, c.PostEvent)
 	}
+}
 
-	cmd := exec.Command("git", "pull")
-	cmd.Dir = s.postsPath
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("git pull failed: %v, output: %s", err, string(output))
+func (s *SyncService) publish(eventType string, data interface{}) {
+	if s.notifier != nil {
+		s.notifier.Publish(eventType, data)
 	}
+}
 
-	log.Printf("git pull ok: %s", string(output))
-	return nil
+// PublicRun is a sync run without error messages, commits or file paths: what the public
+// API and the event stream show.
+type PublicRun struct {
+	ID             int64      `json:"id"`
+	Source         string     `json:"source"`
+	Trigger        string     `json:"trigger"`
+	Status         string     `json:"status"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	Added          int        `json:"added"`
+	Updated        int        `json:"updated"`
+	Deleted        int        `json:"deleted"`
+	FileErrorCount int        `json:"file_error_count"`
 }
 
-func (s *SyncService) scanMarkdownFiles() ([]string, error) {
-	var files []string
+// RedactRun returns the public view of run, nil for nil.
+func RedactRun(run *models.SyncRun) *PublicRun {
+	if run == nil {
+		return nil
+	}
+	return &PublicRun{
+		ID:             run.ID,
+		Source:         run.Source,
+		Trigger:        run.Trigger,
+		Status:         run.Status,
+		StartedAt:      run.StartedAt,
+		FinishedAt:     run.FinishedAt,
+		Added:          run.Added,
+		Updated:        run.Updated,
+		Deleted:        run.Deleted,
+		FileErrorCount: len(run.FileErrors),
+	}
+}
+
+// Reindex re-reads only the given files (absolute paths in the posts dir) without updating
+// the content source: changed posts are updated and posts whose file is gone are deleted.
+// Unlike Sync it records no sync run; the dev watcher calls it on every save. It does not read
+// git history: committed files keep the dates of the last sync, uncommitted ones use mtimes.
+func (s *SyncService) Reindex(ctx context.Context, paths []string) ([]PostChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	err := filepath.Walk(s.postsPath, func(path string, info os.FileInfo, err error) error {
+	dates := s.dates
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Existing files first, so a renamed post is moved rather than deleted and re-added
+	var changes []PostChange
+	var missing []string
+	for _, filePath := range paths {
+		rel := s.relPath(filePath)
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			continue
+		}
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			missing = append(missing, filePath)
+			continue
+		}
+		if !isPostFile(rel) {
+			continue
+		}
+		post, change, err := s.processFile(ctx, tx, filePath, dates)
 		if err != nil {
-			return err
+			s.log().WarnContext(ctx, "process file failed", "file", filePath, "error", err)
+			if err := s.markStale(tx, filePath, s.fileError(filePath, err)); err != nil {
+				s.log().ErrorContext(ctx, "mark post stale failed", "file", filePath, "error", err)
+			}
+			continue
+		}
+		switch change {
+		case changeAdded:
+			changes = append(changes, PostChange{Type: EventPostCreated, PostEvent: post})
+		case changeUpdated:
+			changes = append(changes, PostChange{Type: EventPostUpdated, PostEvent: post})
 		}
+	}
+	for _, filePath := range missing {
+		post := PostEvent{Source: s.source, Path: s.relPath(filePath)}
+		err := tx.QueryRow("SELECT slug, title, category FROM posts WHERE source = ? AND content_path = ?", s.source, filePath).Scan(&post.Slug, &post.Title, &post.Category)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("db query failed: %w", err)
+		}
+		if n, err := s.deletePost(tx, filePath); err != nil {
+			return nil, fmt.Errorf("delete post failed: %w", err)
+		} else if n == 0 {
+			continue
+		}
+		changes = append(changes, PostChange{Type: EventPostDeleted, PostEvent: post})
+	}
 
-		if !info.IsDir() && strings.HasSuffix(path, ".md") {
-			base := filepath.Base(path)
-			if strings.EqualFold(base, "README.md") {
-				return nil
-			}
-			files = append(files, path)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+
+	for _, c := range changes {
+		s.log().InfoContext(ctx, "reindexed", "path", c.Path, "slug", c.Slug, "change", c.Type)
+	}
+	s.publishChanges(changes)
+	return changes, nil
+}
+
+// gitUpdate fetches the tracked branch and hard-resets the working tree to it, so force-pushes
+// and stray local edits on the server can never wedge the sync. Untracked files are removed
+// when cleanUntracked is set. While a pin is active the tree is reset to the pinned commit instead.
+func (s *SyncService) gitUpdate(ctx context.Context) error {
+	pin, err := s.CurrentPin(ctx)
+	if err != nil {
+		return fmt.Errorf("read pin failed: %w", err)
+	}
+	if pin != nil {
+		return s.resetTo(ctx, pin.Commit, "pinned")
+	}
+
+	branch, err := s.trackedBranch(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.withGitTimeout(ctx, "fetch", func(ctx context.Context) error {
+		return s.git.Fetch(ctx, s.postsPath, branch)
+	})
+	if err != nil {
+		return err
+	}
+	return s.resetTo(ctx, "origin/"+branch, branch)
+}
+
+// trackedBranch returns the configured branch, or the one checked out in the posts dir.
+func (s *SyncService) trackedBranch(ctx context.Context) (string, error) {
+	if s.branch != "" {
+		return s.branch, nil
+	}
+	current, err := s.git.CurrentBranch(ctx, s.postsPath)
+	if err != nil {
+		return "", fmt.Errorf("read current branch failed: %w", err)
+	}
+	if current == "" {
+		return "", fmt.Errorf("HEAD is detached and no branch is configured (posts.branch)")
+	}
+	return current, nil
+}
+
+// DefaultBranch returns the branch a blank posts.branch serves: the remote's default branch
+// recorded by the clone (origin/HEAD), or the branch checked out in the posts dir.
+func (s *SyncService) DefaultBranch(ctx context.Context) (string, error) {
+	if s.branch != "" {
+		return s.branch, nil
+	}
+	branch, err := s.git.DefaultBranch(ctx, s.postsPath)
+	if err != nil || branch != "" {
+		return branch, err
+	}
+	return s.trackedBranch(ctx)
+}
+
+// resetTo hard-resets the posts dir to ref; label names the target in the log.
+func (s *SyncService) resetTo(ctx context.Context, ref, label string) error {
+	head, err := s.git.ResetHard(ctx, s.postsPath, ref)
+	if err != nil {
+		return err
+	}
+
+	if s.cleanUntracked {
+		if err := s.git.Clean(ctx, s.postsPath); err != nil {
+			return err
 		}
+	}
+
+	s.log().InfoContext(ctx, "git update ok", "git", s.git.Name(), "ref", label, "commit", fmt.Sprintf("%.12s", head.SHA), "message", head.Message)
+	return nil
+}
 
+// fileDates reads per-file commit dates from the posts repo, deepening a shallow clone first
+// so that creation dates are not all the clone's single commit. It returns nil when the posts
+// dir is not a git repo or history cannot be read; callers then fall back to file mtimes.
+// Walking the history is skipped while HEAD stays at the commit the dates were read at.
+// Call with s.mu held.
+func (s *SyncService) fileDates(ctx context.Context) map[string]FileDates {
+	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); err != nil {
+		s.datesCommit, s.dates = "", nil
 		return nil
-	})
+	}
+	deepened := false
+	if info, err := os.Stat(filepath.Join(s.postsPath, ".git", "shallow")); err == nil && info.Size() > 0 && time.Now().After(s.deepenRetryAt) {
+		s.log().InfoContext(ctx, "posts repo is a shallow clone, fetching full history for post dates")
+		err := s.withGitTimeout(ctx, "deepen", func(ctx context.Context) error {
+			return s.git.Deepen(ctx, s.postsPath)
+		})
+		if err != nil {
+			s.deepenRetryAt = time.Now().Add(deepenRetryInterval)
+			s.log().WarnContext(ctx, "deepen failed, dates may be approximate", "error", err, "retry_after", deepenRetryInterval)
+		} else {
+			deepened = true
+		}
+	}
+	head := s.headCommit(ctx)
+	if !deepened && head != "" && head == s.datesCommit {
+		return s.dates
+	}
+	dates, err := s.git.FileDates(ctx, s.postsPath)
+	if err != nil {
+		s.log().WarnContext(ctx, "read file dates failed", "error", err)
+		return nil
+	}
+	s.datesCommit, s.dates = head, dates
+	return dates
+}
+
+// scanMarkdownFiles returns the posts on disk, regardless of the content source.
+func (s *SyncService) scanMarkdownFiles() ([]string, error) {
+	files, err := listFiles(s.postsPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.postPaths(files), nil
+}
 
-	return files, err
+// listPosts returns the absolute paths of the posts the content source lists.
+func (s *SyncService) listPosts(ctx context.Context) ([]string, error) {
+	files, err := s.content.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.postPaths(files), nil
+}
+
+func (s *SyncService) postPaths(files []string) []string {
+	var paths []string
+	for _, f := range files {
+		if isPostFile(f) {
+			paths = append(paths, filepath.Join(s.postsPath, filepath.FromSlash(f)))
+		}
+	}
+	return paths
 }
 
-func (s *SyncService) getExistingPaths() (map[string]bool, error) {
-	rows, err := s.db.Query("SELECT content_path FROM posts")
+// getExistingPaths returns this source's posts by content path.
+func (s *SyncService) getExistingPaths(tx *sql.Tx) (map[string]PostEvent, error) {
+	rows, err := tx.Query("SELECT content_path, slug, title, category FROM posts WHERE source = ?", s.source)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	paths := make(map[string]bool)
+	paths := make(map[string]PostEvent)
 	for rows.Next() {
 		var path string
-		if err := rows.Scan(&path); err != nil {
+		post := PostEvent{Source: s.source}
+		if err := rows.Scan(&path, &post.Slug, &post.Title, &post.Category); err != nil {
 			return nil, err
 		}
-		paths[path] = true
+		post.Path = s.relPath(path)
+		paths[path] = post
 	}
 
 	return paths, nil
 }
 
-func (s *SyncService) processFile(filePath string) error {
-	fm, _, err := utils.ParseMarkdownFile(filePath)
+// Outcomes of processFile.
+const (
+	changeNone = iota
+	changeAdded
+	changeUpdated
+)
+
+// gitTime returns a commit time for a nullable DATETIME column.
+func gitTime(c Commit) interface{} {
+	if c.SHA == "" {
+		return nil
+	}
+	return c.Date.UTC()
+}
+
+// sameTime compares a stored nullable DATETIME with a commit time.
+func sameTime(stored sql.NullTime, c Commit) bool {
+	if c.SHA == "" {
+		return !stored.Valid
+	}
+	return stored.Valid && stored.Time.Equal(c.Date)
+}
+
+// processFile indexes one post and returns it and what changed.
+func (s *SyncService) processFile(ctx context.Context, tx *sql.Tx, filePath string, dates map[string]FileDates) (PostEvent, int, error) {
+	raw, err := s.content.ReadFile(ctx, s.relPath(filePath))
+	if err != nil {
+		return PostEvent{}, changeNone, fmt.Errorf("read file failed: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	contentHash := hex.EncodeToString(sum[:])
+
+	fm, body, err := utils.ParseMarkdown(string(raw))
 	if err != nil {
-		return fmt.Errorf("parse markdown failed: %w", err)
+		return PostEvent{}, changeNone, fmt.Errorf("parse markdown failed: %w", err)
 	}
 
 	slug := fm.Slug
 	if slug == "" {
 		slug = utils.GenerateSlug(filePath)
 	}
+	slug = s.slugPrefix + slug
+	category := fm.Category
+	if category == "" {
+		category = s.defaultCategory
+	}
+	post := PostEvent{Source: s.source, Slug: slug, Title: fm.Title, Category: category, Path: s.relPath(filePath)}
+
+	// Missing for files outside git history (e.g. uncommitted in dev)
+	fileDates := dates[s.relPath(filePath)]
+
+	change := changeAdded
+	var oldSource, oldPath, oldHash, oldCategory, oldParseError string
+	var oldCreated, oldModified sql.NullTime
+	err = tx.QueryRow("SELECT source, content_path, content_hash, category, parse_error, created_at, last_modified_at FROM posts WHERE slug = ?", slug).
+		Scan(&oldSource, &oldPath, &oldHash, &oldCategory, &oldParseError, &oldCreated, &oldModified)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return PostEvent{}, changeNone, fmt.Errorf("db query failed: %w", err)
+	case oldSource != s.source:
+		// Slugs are unique across the blog; never take over another source's post
+		return PostEvent{}, changeNone, fmt.Errorf("slug %q is already used by source %s", slug, oldSource)
+	case oldPath == filePath && oldHash == contentHash && oldCategory == category && oldParseError == "" &&
+		sameTime(oldCreated, fileDates.Created) && sameTime(oldModified, fileDates.Modified):
+		return post, changeNone, nil
+	default:
+		change = changeUpdated
+	}
 
 	var publishedAt time.Time
 	if fm.PublishedAt != "" {
@@ -231,6 +739,10 @@ func (s *SyncService) processFile(filePath string) error {
 			}
 		}
 	}
+	// Without a front-matter date use the first commit; mtime is only the clone time after a fresh clone
+	if publishedAt.IsZero() && fileDates.Created.SHA != "" {
+		publishedAt = fileDates.Created.Date
+	}
 	if publishedAt.IsZero() {
 		if info, err := os.Stat(filePath); err == nil {
 			publishedAt = info.ModTime()
@@ -240,27 +752,101 @@ func (s *SyncService) processFile(filePath string) error {
 	}
 
 	query := `
-		INSERT INTO posts (slug, title, summary, category, published_at, content_path, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO posts (slug, source, title, summary, category, published_at, content_path, content_hash, body, parse_error,
+			created_at, created_by, last_modified_at, last_modified_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?, ?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(slug) DO UPDATE SET
 			title = excluded.title,
 			summary = excluded.summary,
 			category = excluded.category,
 			published_at = excluded.published_at,
 			content_path = excluded.content_path,
+			content_hash = excluded.content_hash,
+			body = excluded.body,
+			parse_error = '',
+			created_at = excluded.created_at,
+			created_by = excluded.created_by,
+			last_modified_at = excluded.last_modified_at,
+			last_modified_by = excluded.last_modified_by,
 			updated_at = CURRENT_TIMESTAMP
 	`
 
-	_, err = s.db.Exec(query, slug, fm.Title, fm.Summary, fm.Category, publishedAt, filePath)
+	_, err = tx.Exec(query, slug, s.source, fm.Title, fm.Summary, category, publishedAt, filePath, contentHash, body,
+		gitTime(fileDates.Created), fileDates.Created.Author, gitTime(fileDates.Modified), fileDates.Modified.Author)
 	if err != nil {
-		return fmt.Errorf("db exec failed: %w", err)
+		return PostEvent{}, changeNone, fmt.Errorf("db exec failed: %w", err)
 	}
 
-	log.Printf("sync post: %s (%s)", fm.Title, slug)
-	return nil
+	s.log().DebugContext(ctx, "synced post", "title", fm.Title, "slug", slug)
+	return post, change, nil
+}
+
+// log returns the sync logger with the source name.
+func (s *SyncService) log() *slog.Logger {
+	return syncLog.With("source", s.source)
 }
 
-func (s *SyncService) deletePost(contentPath string) error {
-	_, err := s.db.Exec("DELETE FROM posts WHERE content_path = ?", contentPath)
+// fileError builds the diagnostic for a file that failed to sync.
+func (s *SyncService) fileError(filePath string, err error) models.FileError {
+	fileErr := models.FileError{Path: s.relPath(filePath), Message: err.Error()}
+	var fmErr *utils.FrontMatterError
+	if errors.As(err, &fmErr) {
+		fileErr.Line = fmErr.Line
+		fileErr.Column = fmErr.Column
+		fileErr.Message = fmErr.Message
+	}
+	return fileErr
+}
+
+// markStale flags the post last synced from filePath; its previous content keeps being served.
+func (s *SyncService) markStale(tx *sql.Tx, filePath string, fileErr models.FileError) error {
+	msg := fileErr.Message
+	if fileErr.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", fileErr.Line, msg)
+	}
+	_, err := tx.Exec("UPDATE posts SET parse_error = ? WHERE source = ? AND content_path = ?", msg, s.source, filePath)
 	return err
 }
+
+// StalePost is a post whose source file currently fails to parse.
+type StalePost struct {
+	Slug  string `json:"slug"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// StalePosts lists this source's posts served from their last good version because the file fails to parse.
+func (s *SyncService) StalePosts(ctx context.Context) ([]StalePost, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT slug, content_path, parse_error FROM posts WHERE source = ? AND parse_error != '' ORDER BY slug", s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []StalePost{}
+	for rows.Next() {
+		var p StalePost
+		if err := rows.Scan(&p.Slug, &p.Path, &p.Error); err != nil {
+			return nil, err
+		}
+		p.Path = s.relPath(p.Path)
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// relPath returns filePath relative to the posts dir for reporting.
+func (s *SyncService) relPath(filePath string) string {
+	if rel, err := filepath.Rel(s.postsPath, filePath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filePath
+}
+
+func (s *SyncService) deletePost(tx *sql.Tx, contentPath string) (int64, error) {
+	res, err := tx.Exec("DELETE FROM posts WHERE source = ? AND content_path = ?", s.source, contentPath)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"blog-suiseiseki/metrics"
+	"blog-suiseiseki/models"
+)
+
+// Sync triggers recorded in sync_runs.
+const (
+	TriggerStartup  = "startup"
+	TriggerInterval = "interval"
+	TriggerWebhook  = "webhook"
+	TriggerManual   = "manual"
+	TriggerPin      = "pin"   // pin, unpin or rollback from the admin API
+	TriggerWatch    = "watch" // dev file watcher, after a directory was removed or renamed
+)
+
+// Sync run statuses.
+const (
+	RunRunning   = "running"
+	RunOK        = "ok"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+	RunAborted   = "aborted" // process died mid-run; set on next startup
+)
+
+var (
+	syncDuration = metrics.NewHistogram("blog_sync_duration_seconds",
+		"Duration of sync runs by source.", []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}, "source")
+	syncRuns = metrics.NewCounter("blog_sync_runs_total",
+		"Sync runs by source, trigger and outcome (ok, failed or cancelled).", "source", "trigger", "outcome")
+)
+
+const syncRunColumns = `id, source, trigger, status, started_at, finished_at, commit_before, commit_after,
+	added, updated, deleted, error, file_errors`
+
+// startRun inserts a running sync_runs row.
+func (s *SyncService) startRun(run *models.SyncRun) error {
+	res, err := s.db.Exec(`
+		INSERT INTO sync_runs (source, trigger, status, started_at, commit_before)
+		VALUES (?, ?, ?, ?, ?)
+	`, s.source, run.Trigger, run.Status, run.StartedAt, run.CommitBefore)
+	if err != nil {
+		return err
+	}
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+// finishRun stores the outcome of run. It runs outside the sync context so cancelled runs are still recorded.
+func (s *SyncService) finishRun(run *models.SyncRun) error {
+	if run.FileErrors == nil {
+		run.FileErrors = []models.FileError{}
+	}
+	fileErrors, err := json.Marshal(run.FileErrors)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		UPDATE sync_runs SET status = ?, finished_at = ?, commit_after = ?,
+			added = ?, updated = ?, deleted = ?, error = ?, file_errors = ?
+		WHERE id = ?
+	`, run.Status, run.FinishedAt, run.CommitAfter, run.Added, run.Updated, run.Deleted,
+		run.Error, string(fileErrors), run.ID)
+	return err
+}
+
+// LatestRun returns the most recent sync run of this source, or nil if none has been recorded.
+func (s *SyncService) LatestRun(ctx context.Context) (*models.SyncRun, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+syncRunColumns+` FROM sync_runs WHERE source = ? ORDER BY id DESC LIMIT 1`, s.source)
+	run, err := scanSyncRun(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// ListRuns returns sync runs of all sources newest first.
+func (s *SyncService) ListRuns(ctx context.Context, limit, offset int) ([]models.SyncRun, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+syncRunColumns+` FROM sync_runs ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.SyncRun{}
+	for rows.Next() {
+		run, err := scanSyncRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// CountRuns returns the number of recorded sync runs of all sources.
+func (s *SyncService) CountRuns(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sync_runs").Scan(&n)
+	return n, err
+}
+
+// Running reports whether a sync is in progress.
+func (s *SyncService) Running() bool {
+	return s.running.Load()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSyncRun(row rowScanner) (*models.SyncRun, error) {
+	var run models.SyncRun
+	var finishedAt sql.NullTime
+	var fileErrors string
+	err := row.Scan(
+		&run.ID,
+		&run.Source,
+		&run.Trigger,
+		&run.Status,
+		&run.StartedAt,
+		&finishedAt,
+		&run.CommitBefore,
+		&run.CommitAfter,
+		&run.Added,
+		&run.Updated,
+		&run.Deleted,
+		&run.Error,
+		&fileErrors,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	run.FileErrors = []models.FileError{}
+	if fileErrors != "" {
+		if err := json.Unmarshal([]byte(fileErrors), &run.FileErrors); err != nil {
+			return nil, err
+		}
+	}
+	return &run, nil
+}
+
+// headCommit returns the SHA checked out in the posts dir, or "" when it is not a git repo.
+func (s *SyncService) headCommit(ctx context.Context) string {
+	if _, err := os.Stat(filepath.Join(s.postsPath, ".git")); err != nil {
+		return ""
+	}
+	head, err := s.git.Head(ctx, s.postsPath)
+	if err != nil {
+		return ""
+	}
+	return head.SHA
+}
+
+func finishTime() *time.Time {
+	t := time.Now().UTC()
+	return &t
+}
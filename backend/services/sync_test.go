@@ -1,9 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
@@ -40,7 +45,7 @@ Test content.`
 
 	syncService := NewSyncService(db.Conn(), postsDir, true, nil, "")
 
-	if err := syncService.Sync(); err != nil {
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
 		t.Fatalf("sync: %v", err)
 	}
 
@@ -87,13 +92,13 @@ slug: old-post
 # Old Post`), 0644)
 
 	syncService := NewSyncService(db.Conn(), postsDir, true, nil, "")
-	if err := syncService.Sync(); err != nil {
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
 		t.Fatalf("first sync: %v", err)
 	}
 
 	os.Remove(mdFile)
 
-	if err := syncService.Sync(); err != nil {
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
 		t.Fatalf("second sync: %v", err)
 	}
 
@@ -107,3 +112,663 @@ slug: old-post
 		t.Fatalf("want post deleted, still have %d rows", count)
 	}
 }
+
+func TestSyncService_RenameKeepsPost(t *testing.T) {
+	tmpDir := t.TempDir()
+	postsDir := filepath.Join(tmpDir, "posts")
+	os.MkdirAll(postsDir, 0755)
+
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	oldFile := filepath.Join(postsDir, "draft.md")
+	os.WriteFile(oldFile, []byte("---\ntitle: Renamed\nslug: renamed\n---\n\nBody"), 0644)
+
+	events := NewEventBus(DefaultEventBuffer)
+	syncService := NewSyncService(db.Conn(), postsDir, true, events, "")
+	ctx := context.Background()
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	sub := events.Subscribe(events.LastID())
+	defer sub.Close()
+	if err := os.Rename(oldFile, filepath.Join(postsDir, "published.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync after rename: %v", err)
+	}
+
+	run, err := syncService.LatestRun(ctx)
+	if err != nil || run == nil {
+		t.Fatalf("latest run: %v %v", run, err)
+	}
+	if run.Deleted != 0 || run.Updated != 1 {
+		t.Errorf("want the rename counted as one update, got added %d updated %d deleted %d", run.Added, run.Updated, run.Deleted)
+	}
+	var count int
+	db.Conn().QueryRow("SELECT COUNT(*) FROM posts WHERE slug = ?", "renamed").Scan(&count)
+	if count != 1 {
+		t.Errorf("want the renamed post kept, got %d rows", count)
+	}
+	for {
+		select {
+		case ev := <-sub.C:
+			if ev.Type == EventPostDeleted {
+				t.Errorf("want no post_deleted for a renamed post, got %+v", ev)
+			}
+			continue
+		default:
+		}
+		break
+	}
+}
+
+func TestSyncService_MultipleSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	techDir := filepath.Join(tmpDir, "tech")
+	essaysDir := filepath.Join(tmpDir, "essays")
+	os.MkdirAll(techDir, 0755)
+	os.MkdirAll(essaysDir, 0755)
+	os.WriteFile(filepath.Join(techDir, "go.md"), []byte("---\ntitle: Go\nslug: go\ncategory: lang\n---\n\nGo"), 0644)
+	os.WriteFile(filepath.Join(essaysDir, "spring.md"), []byte("---\ntitle: Spring\nslug: spring\n---\n\nSpring"), 0644)
+	// Same front-matter slug as the tech post; the prefix keeps them apart
+	os.WriteFile(filepath.Join(essaysDir, "go.md"), []byte("---\ntitle: Go outside\nslug: go\n---\n\nWalk"), 0644)
+
+	tech := NewSyncService(db.Conn(), techDir, true, nil, "")
+	tech.SetSource("tech")
+	essays := NewSyncService(db.Conn(), essaysDir, true, nil, "")
+	essays.SetSource("essays")
+	essays.SetPostDefaults("essay-", "essays")
+	sources := NewSources(tech, essays)
+
+	if err := sources.SyncAll(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	posts := func() map[string]string {
+		t.Helper()
+		rows, err := db.Conn().Query("SELECT slug, source, category FROM posts")
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		defer rows.Close()
+		got := make(map[string]string)
+		for rows.Next() {
+			var slug, source, category string
+			rows.Scan(&slug, &source, &category)
+			got[slug] = source + "/" + category
+		}
+		return got
+	}
+	want := map[string]string{"go": "tech/lang", "essay-go": "essays/essays", "essay-spring": "essays/essays"}
+	if got := posts(); len(got) != len(want) || got["go"] != want["go"] || got["essay-go"] != want["essay-go"] || got["essay-spring"] != want["essay-spring"] {
+		t.Fatalf("want posts %v, got %v", want, got)
+	}
+
+	// Emptying one source must not delete the other's posts
+	os.Remove(filepath.Join(techDir, "go.md"))
+	if err := tech.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("sync tech: %v", err)
+	}
+	if got := posts(); len(got) != 2 || got["go"] != "" {
+		t.Errorf("want only the essays left, got %v", got)
+	}
+
+	// A slug owned by another source is reported, not taken over
+	os.WriteFile(filepath.Join(techDir, "spring.md"), []byte("---\ntitle: Spring Boot\nslug: essay-spring\n---\n\nBoot"), 0644)
+	if err := tech.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("sync tech: %v", err)
+	}
+	run, err := tech.LatestRun(context.Background())
+	if err != nil || run == nil {
+		t.Fatalf("latest run: %v", err)
+	}
+	if run.Source != "tech" || len(run.FileErrors) != 1 || !strings.Contains(run.FileErrors[0].Message, "source essays") {
+		t.Errorf("want slug conflict recorded on the tech run, got %+v", run)
+	}
+	if got := posts(); got["essay-spring"] != "essays/essays" {
+		t.Errorf("want essay-spring kept by essays, got %v", got)
+	}
+
+	// Dropping a source from the configuration prunes its posts
+	if err := NewSources(essays).Prune(context.Background()); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	var n int
+	db.Conn().QueryRow("SELECT COUNT(*) FROM posts WHERE source = 'tech'").Scan(&n)
+	if n != 0 {
+		t.Errorf("want tech posts pruned, got %d", n)
+	}
+}
+
+func TestSyncService_CancelledSyncKeepsIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	postsDir := filepath.Join(tmpDir, "posts")
+
+	os.MkdirAll(postsDir, 0755)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	mdFile := filepath.Join(postsDir, "kept-post.md")
+	os.WriteFile(mdFile, []byte(`---
+title: Kept Post
+slug: kept-post
+---
+
+# Kept Post`), 0644)
+
+	syncService := NewSyncService(db.Conn(), postsDir, true, nil, "")
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	os.Remove(mdFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := syncService.Sync(ctx, TriggerManual); err == nil {
+		t.Fatal("want error from cancelled sync")
+	}
+
+	var count int
+	err = db.Conn().QueryRow("SELECT COUNT(*) FROM posts WHERE slug = ?", "kept-post").Scan(&count)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("cancelled sync should not touch the index, got %d rows", count)
+	}
+}
+
+func TestSyncService_GitTimeout(t *testing.T) {
+	syncService := NewSyncService(nil, t.TempDir(), false, nil, "")
+	syncService.SetGitBackend(NewExecGitBackend())
+	syncService.SetGitTimeout(time.Nanosecond)
+
+	err := syncService.gitClone(context.Background(), "https://example.invalid/posts.git", filepath.Join(t.TempDir(), "posts"))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("want timeout error, got %v", err)
+	}
+}
+
+func TestSyncService_RecordsRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	postsDir := filepath.Join(tmpDir, "posts")
+
+	os.MkdirAll(postsDir, 0755)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	first := filepath.Join(postsDir, "first.md")
+	second := filepath.Join(postsDir, "second.md")
+	os.WriteFile(first, []byte("---\ntitle: First\n---\n\nBody"), 0644)
+	os.WriteFile(second, []byte("---\ntitle: Second\n---\n\nBody"), 0644)
+
+	syncService := NewSyncService(db.Conn(), postsDir, true, nil, "")
+	if err := syncService.Sync(context.Background(), TriggerStartup); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	os.WriteFile(first, []byte("---\ntitle: First (edited)\n---\n\nBody"), 0644)
+	os.Remove(second)
+	if err := syncService.Sync(context.Background(), TriggerWebhook); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+
+	runs, err := syncService.ListRuns(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("want 2 runs, got %d", len(runs))
+	}
+
+	latest := runs[0]
+	if latest.Trigger != TriggerWebhook || latest.Status != RunOK {
+		t.Errorf("want webhook/ok, got %s/%s", latest.Trigger, latest.Status)
+	}
+	if latest.Added != 0 || latest.Updated != 1 || latest.Deleted != 1 {
+		t.Errorf("want 0 added, 1 updated, 1 deleted, got %d/%d/%d", latest.Added, latest.Updated, latest.Deleted)
+	}
+	if latest.FinishedAt == nil {
+		t.Error("finished run should have finished_at")
+	}
+	if runs[1].Added != 2 {
+		t.Errorf("want 2 added in first run, got %d", runs[1].Added)
+	}
+}
+
+func TestSyncService_BrokenFileKeepsLastGoodVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	postsDir := filepath.Join(tmpDir, "posts")
+
+	os.MkdirAll(postsDir, 0755)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	mdFile := filepath.Join(postsDir, "post.md")
+	os.WriteFile(mdFile, []byte("---\ntitle: Good\nslug: post\n---\n\nGood body"), 0644)
+
+	events := NewEventBus(DefaultEventBuffer)
+	syncService := NewSyncService(db.Conn(), postsDir, true, events, "")
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	sub := events.Subscribe(events.LastID())
+	defer sub.Close()
+	os.WriteFile(mdFile, []byte("---\ntitle: Broken\nslug: [post\n---\n\nBroken body"), 0644)
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	for ev := range sub.C {
+		if ev.Type != EventSyncCompleted {
+			continue
+		}
+		// The event stream is public: it gets the count, not the file path
+		if run, ok := ev.Data.(*PublicRun); !ok || run.FileErrorCount != 1 {
+			t.Errorf("want a redacted run with 1 file error published, got %#v", ev.Data)
+		}
+		break
+	}
+
+	var title, body, parseError string
+	err = db.Conn().QueryRow("SELECT title, body, parse_error FROM posts WHERE slug = ?", "post").Scan(&title, &body, &parseError)
+	if err != nil {
+		t.Fatalf("query post: %v", err)
+	}
+	if title != "Good" || !strings.Contains(body, "Good body") {
+		t.Errorf("want last good version kept, got title %q body %q", title, body)
+	}
+	if parseError == "" {
+		t.Error("want post flagged with parse error")
+	}
+
+	run, err := syncService.LatestRun(context.Background())
+	if err != nil {
+		t.Fatalf("latest run: %v", err)
+	}
+	if len(run.FileErrors) != 1 {
+		t.Fatalf("want 1 file error, got %d", len(run.FileErrors))
+	}
+	if fe := run.FileErrors[0]; fe.Path != "post.md" || fe.Line == 0 {
+		t.Errorf("want diagnostic for post.md with a line, got %+v", fe)
+	}
+
+	stale, err := syncService.StalePosts(context.Background())
+	if err != nil {
+		t.Fatalf("stale posts: %v", err)
+	}
+	if len(stale) != 1 || stale[0].Slug != "post" {
+		t.Errorf("want post listed as stale, got %+v", stale)
+	}
+
+	os.WriteFile(mdFile, []byte("---\ntitle: Good\nslug: post\n---\n\nGood body"), 0644)
+	if err := syncService.Sync(context.Background(), TriggerManual); err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	if stale, _ := syncService.StalePosts(context.Background()); len(stale) != 0 {
+		t.Errorf("want no stale posts after fix, got %+v", stale)
+	}
+}
+
+func TestSyncService_ResetsToRemoteAfterForcePush(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	remote := newTestRemote(t)
+	postsDir := filepath.Join(tmpDir, "posts")
+
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "file://"+remote)
+	syncService.SetCleanUntracked(true)
+	if err := syncService.Sync(context.Background(), TriggerStartup); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	// Stray edits on the server and a force-push upstream
+	os.WriteFile(filepath.Join(postsDir, "hello.md"), []byte("---\ntitle: Local edit\n---\n"), 0644)
+	os.WriteFile(filepath.Join(postsDir, "stray.md"), []byte("---\ntitle: Stray\n---\n"), 0644)
+	os.WriteFile(filepath.Join(remote, "hello.md"), []byte("---\ntitle: Rewritten\n---\n\nHello"), 0644)
+	gitCmd(t, remote, "commit", "-a", "--amend", "-m", "Rewrite hello")
+
+	if err := syncService.Sync(context.Background(), TriggerWebhook); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+
+	var titles []string
+	rows, err := db.Conn().Query("SELECT title FROM posts ORDER BY title")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var title string
+		rows.Scan(&title)
+		titles = append(titles, title)
+	}
+	if len(titles) != 1 || titles[0] != "Rewritten" {
+		t.Fatalf("want only the remote version indexed, got %v", titles)
+	}
+
+	run, err := syncService.LatestRun(context.Background())
+	if err != nil {
+		t.Fatalf("latest run: %v", err)
+	}
+	remoteHead, err := NewExecGitBackend().Head(context.Background(), remote)
+	if err != nil {
+		t.Fatalf("remote head: %v", err)
+	}
+	if run.CommitAfter != remoteHead.SHA {
+		t.Errorf("want run commit %s, got %s", remoteHead.SHA, run.CommitAfter)
+	}
+}
+
+func TestSyncService_PinAndRollback(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	remote := newTestRemote(t)
+	postsDir := filepath.Join(tmpDir, "posts")
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "file://"+remote)
+
+	title := func() string {
+		t.Helper()
+		var title string
+		if err := db.Conn().QueryRow("SELECT title FROM posts WHERE slug = 'hello'").Scan(&title); err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		return title
+	}
+
+	if err := syncService.Sync(ctx, TriggerStartup); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	good := syncService.headCommit(ctx)
+
+	commitFile(t, remote, "hello.md", "---\ntitle: Bad push\n---\n", "Break hello")
+	if err := syncService.Sync(ctx, TriggerWebhook); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if got := title(); got != "Bad push" {
+		t.Fatalf("want bad push served before rollback, got %q", got)
+	}
+
+	if _, err := syncService.Rollback(ctx, "0000000", ""); err != ErrNotRollbackTarget {
+		t.Errorf("want ErrNotRollbackTarget for unknown commit, got %v", err)
+	}
+	pin, err := syncService.Rollback(ctx, good[:12], "bad push")
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if pin.Commit != good || pin.Reason != "bad push" {
+		t.Errorf("unexpected pin: %+v", pin)
+	}
+	if err := syncService.Sync(ctx, TriggerPin); err != nil {
+		t.Fatalf("sync after rollback: %v", err)
+	}
+	if got := title(); got != "Hello" {
+		t.Errorf("want rolled back title Hello, got %q", got)
+	}
+
+	// New pushes are not served while pinned
+	commitFile(t, remote, "hello.md", "---\ntitle: Fixed\n---\n", "Fix hello")
+	if err := syncService.Sync(ctx, TriggerInterval); err != nil {
+		t.Fatalf("pinned sync: %v", err)
+	}
+	if got := title(); got != "Hello" {
+		t.Errorf("want pinned title Hello, got %q", got)
+	}
+	if head := syncService.headCommit(ctx); head != good {
+		t.Errorf("want posts dir held at %s, got %s", good, head)
+	}
+
+	if removed, err := syncService.Unpin(ctx); err != nil || !removed {
+		t.Fatalf("unpin: removed=%v err=%v", removed, err)
+	}
+	if err := syncService.Sync(ctx, TriggerPin); err != nil {
+		t.Fatalf("sync after unpin: %v", err)
+	}
+	if got := title(); got != "Fixed" {
+		t.Errorf("want latest title after unpin, got %q", got)
+	}
+	if pin, _ := syncService.CurrentPin(ctx); pin != nil {
+		t.Errorf("want no pin, got %+v", pin)
+	}
+
+	// Dev syncs never reset the posts dir, so a pin is refused instead of silently ignored
+	devService := NewSyncService(db.Conn(), postsDir, true, nil, "")
+	if _, err := devService.Pin(ctx, "", ""); err != ErrPinInDev {
+		t.Errorf("want ErrPinInDev, got %v", err)
+	}
+	if _, err := devService.Rollback(ctx, good[:12], ""); err != ErrPinInDev {
+		t.Errorf("want ErrPinInDev for rollback, got %v", err)
+	}
+}
+
+func TestSyncService_GitDates(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	for _, name := range []string{GitBackendGoGit, GitBackendExec} {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			db, err := database.New(filepath.Join(tmpDir, "test.db"))
+			if err != nil {
+				t.Fatalf("create db: %v", err)
+			}
+			defer db.Close()
+
+			t.Setenv("GIT_AUTHOR_DATE", "2023-03-01T10:00:00Z")
+			remote := newTestRemote(t)
+			t.Setenv("GIT_AUTHOR_DATE", "2024-05-02T10:00:00Z")
+			commitFile(t, remote, "hello.md", "---\ntitle: Hello again\n---\n\nEdited", "Edit hello")
+
+			backend, _ := NewGitBackend(name)
+			syncService := NewSyncService(db.Conn(), filepath.Join(tmpDir, "posts"), false, nil, "file://"+remote)
+			syncService.SetGitBackend(backend)
+			if err := syncService.Sync(context.Background(), TriggerStartup); err != nil {
+				t.Fatalf("sync: %v", err)
+			}
+
+			var publishedAt, createdAt, modifiedAt time.Time
+			var createdBy string
+			err = db.Conn().QueryRow("SELECT published_at, created_at, created_by, last_modified_at FROM posts WHERE slug = 'hello'").
+				Scan(&publishedAt, &createdAt, &createdBy, &modifiedAt)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			// The clone is shallow; creation must come from the deepened history, not the clone
+			if want := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC); !createdAt.Equal(want) || !publishedAt.Equal(want) {
+				t.Errorf("want created/published %v, got %v / %v", want, createdAt, publishedAt)
+			}
+			if want := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC); !modifiedAt.Equal(want) {
+				t.Errorf("want last modified %v, got %v", want, modifiedAt)
+			}
+			if createdBy != "Test Author" {
+				t.Errorf("want created_by Test Author, got %q", createdBy)
+			}
+		})
+	}
+}
+
+// countingGit counts the history walks, file logs and deepens of a backend.
+type countingGit struct {
+	GitBackend
+	failDeepen                   bool
+	fileDates, fileLogs, deepens int
+}
+
+func (g *countingGit) FileLog(ctx context.Context, dir, path string) ([]Commit, error) {
+	g.fileLogs++
+	return g.GitBackend.FileLog(ctx, dir, path)
+}
+
+func (g *countingGit) FileDates(ctx context.Context, dir string) (map[string]FileDates, error) {
+	g.fileDates++
+	return g.GitBackend.FileDates(ctx, dir)
+}
+
+func (g *countingGit) Deepen(ctx context.Context, dir string) error {
+	g.deepens++
+	if g.failDeepen {
+		return errors.New("remote hung up")
+	}
+	return g.GitBackend.Deepen(ctx, dir)
+}
+
+func TestSyncService_FileDatesCached(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	remote := newTestRemote(t)
+	git := &countingGit{GitBackend: NewGoGitBackend(), failDeepen: true}
+	syncService := NewSyncService(db.Conn(), filepath.Join(tmpDir, "posts"), false, nil, "file://"+remote)
+	syncService.SetGitBackend(git)
+
+	syncOnce := func() {
+		t.Helper()
+		if err := syncService.Sync(ctx, TriggerInterval); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	syncOnce()
+	if git.fileDates != 1 || git.deepens != 1 {
+		t.Fatalf("want one history walk and one deepen of the shallow clone, got %d and %d", git.fileDates, git.deepens)
+	}
+	// HEAD did not move: no walk, and the failed deepen is not retried on every run
+	syncOnce()
+	if git.fileDates != 1 || git.deepens != 1 {
+		t.Errorf("want dates reused at the same HEAD, got %d walks and %d deepens", git.fileDates, git.deepens)
+	}
+	commitFile(t, remote, "other.md", "# Other", "Add other")
+	syncOnce()
+	if git.fileDates != 2 || git.deepens != 1 {
+		t.Errorf("want dates read again after HEAD moved without a deepen retry, got %d walks and %d deepens", git.fileDates, git.deepens)
+	}
+
+	// Saves in dev reindex single files without touching git; committed dates are kept
+	hello := filepath.Join(tmpDir, "posts", "hello.md")
+	if err := os.WriteFile(hello, []byte("---\ntitle: Hello edited\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncService.Reindex(ctx, []string{hello}); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if git.fileDates != 2 || git.deepens != 1 {
+		t.Errorf("want no git calls on reindex, got %d walks and %d deepens", git.fileDates, git.deepens)
+	}
+	var createdBy string
+	if err := db.Conn().QueryRow("SELECT created_by FROM posts WHERE slug = 'hello'").Scan(&createdBy); err != nil || createdBy != "Test Author" {
+		t.Errorf("want the committed author kept after reindex, got %q (%v)", createdBy, err)
+	}
+}
+
+func TestSyncService_FileDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available to build the test remote")
+	}
+
+	tmpDir := t.TempDir()
+	db, err := database.New(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("create db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	remote := newTestRemote(t)
+	commitFile(t, remote, "hello.md", "---\ntitle: Hello\n---\n\nHello, world", "Expand hello")
+	commitFile(t, remote, "other.md", "# Other", "Add other")
+
+	postsDir := filepath.Join(tmpDir, "posts")
+	git := &countingGit{GitBackend: NewGoGitBackend()}
+	syncService := NewSyncService(db.Conn(), postsDir, false, nil, "file://"+remote)
+	syncService.SetGitBackend(git)
+	if err := syncService.Sync(ctx, TriggerStartup); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	hello := filepath.Join(postsDir, "hello.md")
+	history, err := syncService.FileHistory(ctx, hello)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if _, err := syncService.FileHistory(ctx, hello); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if git.fileLogs != 1 {
+		t.Errorf("want the file log read once while HEAD stays, got %d reads", git.fileLogs)
+	}
+	if len(history) != 2 || history[0].Message != "Expand hello" || history[1].Message != "Add hello" {
+		t.Fatalf("want the two commits touching hello.md, got %+v", history)
+	}
+
+	d, err := syncService.FileDiff(ctx, hello, "", "")
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if d.From.SHA != history[1].SHA || d.To.SHA != history[0].SHA {
+		t.Errorf("want default range first..latest, got %s..%s", d.From.SHA, d.To.SHA)
+	}
+	if !strings.Contains(d.Diff, "-Hello\n") || !strings.Contains(d.Diff, "+Hello, world") {
+		t.Errorf("unexpected diff:\n%s", d.Diff)
+	}
+
+	if _, err := syncService.FileDiff(ctx, hello, "--output=/tmp/x", ""); err == nil {
+		t.Error("want error for an option-like revision")
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"blog-suiseiseki/logging"
+)
+
+var systemdLog = logging.New("systemd")
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// SdNotify sends a state such as "READY=1" or "WATCHDOG=1" to systemd (see sd_notify(3)).
+// Outside a Type=notify unit NOTIFY_SOCKET is unset and it does nothing.
+func SdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract socket
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify failed: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify failed: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the WatchdogSec of the unit, 0 when the watchdog is off or meant
+// for another process.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog sends WATCHDOG=1 at half the watchdog interval while check passes, until ctx is
+// done. A failing or hanging check (e.g. a deadlocked DB) stops the pings, so systemd
+// restarts the service.
+func RunWatchdog(ctx context.Context, interval time.Duration, check func(context.Context) error) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+			err := check(checkCtx)
+			cancel()
+			if err != nil {
+				systemdLog.Warn("watchdog: health check failed, not pinging", "error", err)
+				continue
+			}
+			if err := SdNotify("WATCHDOG=1"); err != nil {
+				systemdLog.Warn("watchdog ping failed", "error", err)
+			}
+		}
+	}
+}
+
+// ExtendStartTimeout asks systemd for another 2*every of start-up time now and then every
+// interval until ctx is done, so a slow startup sync (several git timeouts) does not hit
+// TimeoutStartSec. Call it before READY=1; systemd ignores it once the unit is active.
+func ExtendStartTimeout(ctx context.Context, every time.Duration) {
+	extend := fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d", (2 * every).Microseconds())
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := SdNotify(extend); err != nil {
+			systemdLog.Warn("extend start timeout failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListenFDs returns the sockets passed by systemd socket activation (LISTEN_FDS), nil when
+// the process was not socket-activated. The variables are unset so children do not inherit them.
+func ListenFDs() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close() // FileListener dups the descriptor
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen fd %d failed: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// ListenUnix listens on a Unix socket at path, replacing a stale socket left by a previous
+// run. The socket is group-writable so a reverse proxy in the server's group can connect.
+func ListenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s failed: %w", path, err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("chmod %s failed: %w", path, err)
+	}
+	return l, nil
+}
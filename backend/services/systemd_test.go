@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// notifySocket listens where SdNotify sends and returns the received datagrams.
+func notifySocket(t *testing.T) <-chan string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	states := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			states <- string(buf[:n])
+		}
+	}()
+	return states
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := SdNotify("READY=1"); err != nil {
+		t.Errorf("want no-op without NOTIFY_SOCKET, got %v", err)
+	}
+
+	states := notifySocket(t)
+	if err := SdNotify("READY=1"); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	select {
+	case got := <-states:
+		if got != "READY=1" {
+			t.Errorf("want READY=1, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", self, 30 * time.Second},
+		{"30000000", "1", 0}, // meant for another process
+		{"garbage", "", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := WatchdogInterval(); got != tt.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: want %s, got %s", tt.usec, tt.pid, tt.want, got)
+		}
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+	states := notifySocket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthy := make(chan bool, 1)
+	healthy <- false
+	go RunWatchdog(ctx, 40*time.Millisecond, func(context.Context) error {
+		select {
+		case ok := <-healthy:
+			if !ok {
+				return errors.New("db down")
+			}
+		default:
+		}
+		return nil
+	})
+
+	// The first check fails and sends nothing; the following ones ping
+	start := time.Now()
+	select {
+	case got := <-states:
+		if got != "WATCHDOG=1" || time.Since(start) < 35*time.Millisecond {
+			t.Errorf("want WATCHDOG=1 after the failed check, got %q after %s", got, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no watchdog ping received")
+	}
+}
+
+func TestExtendStartTimeout(t *testing.T) {
+	states := notifySocket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ExtendStartTimeout(ctx, 30*time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-states:
+			if got != "EXTEND_TIMEOUT_USEC=60000" {
+				t.Errorf("want EXTEND_TIMEOUT_USEC=60000, got %q", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("extension %d not received", i+1)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want ExtendStartTimeout to return once ctx is done")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.sock")
+	first, err := ListenUnix(path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// A socket file left by a crashed run must not block the next start
+	first.(*net.UnixListener).SetUnlinkOnClose(false)
+	first.Close()
+
+	l, err := ListenUnix(path)
+	if err != nil {
+		t.Fatalf("listen over stale socket: %v", err)
+	}
+	defer l.Close()
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0660 {
+		t.Errorf("want socket mode 0660, got %v (%v)", fi.Mode(), err)
+	}
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+
+	// Other files are not removed
+	other := filepath.Join(t.TempDir(), "data")
+	os.WriteFile(other, []byte("x"), 0644)
+	if _, err := ListenUnix(other); err == nil {
+		t.Error("want an error listening on a regular file")
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"blog-suiseiseki/logging"
+)
+
+// DefaultWatchDebounce is how long the watcher waits for writes to settle before reindexing.
+const DefaultWatchDebounce = 300 * time.Millisecond
+
+var watchLog = logging.New("watch")
+
+// Watcher reindexes posts as soon as their files change on disk, for editing in dev mode.
+// Events are debounced so an editor's write, rename and chmod of one save cause a single
+// reindex of just the touched files. Removing or renaming a directory falls back to a full
+// sync, since the posts it contained are not known from the event.
+type Watcher struct {
+	s        *SyncService
+	debounce time.Duration
+
+	fsw  *fsnotify.Watcher
+	dirs map[string]bool // watched directories
+}
+
+func NewWatcher(s *SyncService, debounce time.Duration) *Watcher {
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+	return &Watcher{s: s, debounce: debounce}
+}
+
+// Run watches the posts dir until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher failed: %w", err)
+	}
+	defer fsw.Close()
+	w.fsw = fsw
+	w.dirs = make(map[string]bool)
+
+	if _, err := w.addTree(w.s.postsPath); err != nil {
+		return fmt.Errorf("watch %s failed: %w", w.s.postsPath, err)
+	}
+	watchLog.Info("watching", "source", w.s.source, "path", w.s.postsPath, "dirs", len(w.dirs))
+
+	pending := make(map[string]bool)
+	resync := false
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			watchLog.Warn("watch error", "source", w.s.source, "error", err)
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if w.handle(ev, pending) {
+				resync = true
+			}
+			fire = time.After(w.debounce)
+		case <-fire:
+			fire = nil
+			w.flush(ctx, pending, resync)
+			pending = make(map[string]bool)
+			resync = false
+		}
+	}
+}
+
+// handle records the files touched by ev and reports whether a full sync is needed.
+func (w *Watcher) handle(ev fsnotify.Event, pending map[string]bool) bool {
+	rel, err := filepath.Rel(w.s.postsPath, ev.Name)
+	if err != nil || isGitPath(rel) {
+		return false
+	}
+
+	if ev.Has(fsnotify.Create) {
+		if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+			// Files may have been created before the directory was watched
+			files, err := w.addTree(ev.Name)
+			if err != nil {
+				watchLog.Warn("watch new directory failed", "source", w.s.source, "path", ev.Name, "error", err)
+			}
+			for _, f := range files {
+				pending[f] = true
+			}
+			return false
+		}
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		if w.dirs[ev.Name] {
+			for dir := range w.dirs {
+				if dir == ev.Name || strings.HasPrefix(dir, ev.Name+string(filepath.Separator)) {
+					delete(w.dirs, dir)
+				}
+			}
+			return true
+		}
+	}
+	if isPostFile(ev.Name) {
+		pending[ev.Name] = true
+	}
+	return false
+}
+
+func (w *Watcher) flush(ctx context.Context, pending map[string]bool, resync bool) {
+	if resync {
+		if err := w.s.Sync(ctx, TriggerWatch); err != nil {
+			watchLog.ErrorContext(ctx, "sync failed", "source", w.s.source, "error", err)
+		}
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(pending))
+	for p := range pending {
+		paths = append(paths, p)
+	}
+	if _, err := w.s.Reindex(ctx, paths); err != nil {
+		watchLog.ErrorContext(ctx, "reindex failed", "source", w.s.source, "error", err)
+	}
+}
+
+// addTree watches dir and its subdirectories (fsnotify is not recursive) and returns the
+// posts found in them.
+func (w *Watcher) addTree(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if isPostFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return err
+		}
+		w.dirs[path] = true
+		return nil
+	})
+	return files, err
+}
+
+// isGitPath reports whether a path relative to the posts dir is inside .git.
+func isGitPath(rel string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part == ".git" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type postEvent struct {
+	typ  string
+	slug string
+}
+
+// recordingNotifier collects the post events published by a SyncService.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []postEvent
+}
+
+func (n *recordingNotifier) Publish(eventType string, data interface{}) Event {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if pe, ok := data.(PostEvent); ok {
+		n.events = append(n.events, postEvent{eventType, pe.Slug})
+	}
+	return Event{Type: eventType, Data: data}
+}
+
+func (n *recordingNotifier) Events() []postEvent {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]postEvent(nil), n.events...)
+}
+
+func TestReindex(t *testing.T) {
+	db := newContentTestDB(t)
+	postsDir := t.TempDir()
+	a := filepath.Join(postsDir, "a.md")
+	b := filepath.Join(postsDir, "b.md")
+	os.WriteFile(a, []byte("---\ntitle: A\nslug: a\n---\n\nA"), 0644)
+	os.WriteFile(b, []byte("---\ntitle: B\nslug: b\n---\n\nB"), 0644)
+
+	notifier := &recordingNotifier{}
+	syncService := NewSyncService(db.Conn(), postsDir, true, notifier, "")
+	ctx := context.Background()
+	if err := syncService.Sync(ctx, TriggerManual); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	notifier.events = nil
+
+	os.WriteFile(a, []byte("---\ntitle: A2\nslug: a\n---\n\nA2"), 0644)
+	os.Remove(b)
+	c := filepath.Join(postsDir, "c.md")
+	os.WriteFile(c, []byte("---\ntitle: C\nslug: c\n---\n\nC"), 0644)
+
+	// c.md is not passed, so it must not be indexed
+	changes, err := syncService.Reindex(ctx, []string{a, b, filepath.Join(postsDir, "img.png")})
+	if err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	want := []PostChange{
+		{Type: EventPostUpdated, PostEvent: PostEvent{Source: DefaultSource, Slug: "a", Title: "A2", Path: "a.md"}},
+		{Type: EventPostDeleted, PostEvent: PostEvent{Source: DefaultSource, Slug: "b", Title: "B", Path: "b.md"}},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("want changes %+v, got %+v", want, changes)
+	}
+	if events := notifier.Events(); len(events) != 2 || events[0] != (postEvent{EventPostUpdated, "a"}) || events[1] != (postEvent{EventPostDeleted, "b"}) {
+		t.Errorf("want post events for a and b, got %+v", events)
+	}
+
+	var title string
+	db.Conn().QueryRow("SELECT title FROM posts WHERE slug = 'a'").Scan(&title)
+	if n := countPosts(t, db); n != 1 || title != "A2" {
+		t.Errorf("want only the updated post a, got %d posts, title %q", n, title)
+	}
+	if n, _ := syncService.CountRuns(ctx); n != 1 {
+		t.Errorf("want reindex not recorded as a sync run, got %d runs", n)
+	}
+
+	// Unchanged files produce no events
+	changes, err = syncService.Reindex(ctx, []string{a})
+	if err != nil || len(changes) != 0 {
+		t.Errorf("want no changes for an unchanged file, got %+v, %v", changes, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	db := newContentTestDB(t)
+	postsDir := t.TempDir()
+	os.WriteFile(filepath.Join(postsDir, "a.md"), []byte("---\ntitle: A\nslug: a\n---\n\nA"), 0644)
+
+	notifier := &recordingNotifier{}
+	syncService := NewSyncService(db.Conn(), postsDir, true, notifier, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := syncService.Sync(ctx, TriggerStartup); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- NewWatcher(syncService, 20*time.Millisecond).Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s; events %+v", what, notifier.Events())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	hasEvent := func(ev postEvent) func() bool {
+		return func() bool {
+			for _, e := range notifier.Events() {
+				if e == ev {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	// The watcher registers asynchronously; keep writing until the edit is picked up
+	waitFor("edit", func() bool {
+		os.WriteFile(filepath.Join(postsDir, "a.md"), []byte("---\ntitle: A2\nslug: a\n---\n\nA2"), 0644)
+		time.Sleep(50 * time.Millisecond)
+		return hasEvent(postEvent{EventPostUpdated, "a"})()
+	})
+
+	// A post in a new subdirectory
+	os.MkdirAll(filepath.Join(postsDir, "notes"), 0755)
+	os.WriteFile(filepath.Join(postsDir, "notes", "n.md"), []byte("---\ntitle: N\nslug: n\n---\n\nN"), 0644)
+	waitFor("new post in new dir", hasEvent(postEvent{EventPostCreated, "n"}))
+
+	os.Remove(filepath.Join(postsDir, "a.md"))
+	waitFor("delete", hasEvent(postEvent{EventPostDeleted, "a"}))
+
+	if n, _ := syncService.CountRuns(ctx); n != 1 {
+		t.Errorf("want file edits reindexed without a full sync, got %d runs", n)
+	}
+}
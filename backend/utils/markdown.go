@@ -2,8 +2,11 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/yuin/goldmark"
@@ -18,6 +21,27 @@ type FrontMatter struct {
 	Slug        string `yaml:"slug"`
 }
 
+// Match the "line N: " prefix yaml.v3 puts in error messages.
+var reYAMLLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// FrontMatterError locates a front-matter problem in the Markdown file.
+// Line and Column are 1-based file positions; 0 means unknown.
+type FrontMatterError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *FrontMatterError) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("front-matter line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("front-matter line %d: %s", e.Line, e.Message)
+	}
+	return "front-matter: " + e.Message
+}
+
 // ParseMarkdownFile parses a Markdown file and extracts front-matter and body.
 func ParseMarkdownFile(filePath string) (*FrontMatter, string, error) {
 	content, err := os.ReadFile(filePath)
@@ -42,12 +66,71 @@ func ParseMarkdown(content string) (*FrontMatter, string, error) {
 	frontMatterStr := parts[1]
 	markdownContent := parts[2]
 
-	var fm FrontMatter
-	if err := yaml.Unmarshal([]byte(frontMatterStr), &fm); err != nil {
+	fm, err := decodeFrontMatter(frontMatterStr)
+	if err != nil {
 		return nil, "", err
 	}
 
-	return &fm, markdownContent, nil
+	return fm, markdownContent, nil
+}
+
+// decodeFrontMatter decodes front-matter YAML, reporting errors as *FrontMatterError.
+func decodeFrontMatter(src string) (*FrontMatter, error) {
+	// Front-matter starts on the line after the opening "---"
+	const lineOffset = 1
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		line, msg := splitYAMLError(err.Error())
+		if line > 0 {
+			line += lineOffset
+		}
+		return nil, &FrontMatterError{Line: line, Message: msg}
+	}
+
+	var fm FrontMatter
+	if doc.Kind == 0 {
+		return &fm, nil // empty front-matter
+	}
+	err := doc.Decode(&fm)
+	if err == nil {
+		return &fm, nil
+	}
+
+	// Decode fields one by one to find the offending value and its column
+	if root := doc.Content[0]; root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			pair := &yaml.Node{Kind: yaml.MappingNode, Content: root.Content[i : i+2]}
+			var scratch FrontMatter
+			if ferr := pair.Decode(&scratch); ferr != nil {
+				value := root.Content[i+1]
+				_, msg := splitYAMLError(firstYAMLError(ferr))
+				return nil, &FrontMatterError{Line: value.Line + lineOffset, Column: value.Column, Message: msg}
+			}
+		}
+	}
+	line, msg := splitYAMLError(firstYAMLError(err))
+	if line > 0 {
+		line += lineOffset
+	}
+	return nil, &FrontMatterError{Line: line, Message: msg}
+}
+
+func firstYAMLError(err error) string {
+	if te, ok := err.(*yaml.TypeError); ok && len(te.Errors) > 0 {
+		return te.Errors[0]
+	}
+	return err.Error()
+}
+
+// splitYAMLError separates the line number yaml.v3 embeds in messages.
+func splitYAMLError(msg string) (int, string) {
+	m := reYAMLLine.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, strings.TrimPrefix(msg, "yaml: ")
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line, msg[len(m[0]):]
 }
 
 // MarkdownToHTML converts Markdown to HTML.
@@ -126,3 +126,40 @@ func TestGenerateSlug(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMarkdownFrontMatterError(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantLine   int
+		wantColumn int
+	}{
+		{
+			name:       "wrong type",
+			content:    "---\ntitle: ok\nslug: [a, b]\n---\n\nBody",
+			wantLine:   3,
+			wantColumn: 7,
+		},
+		{
+			name:     "syntax error",
+			content:  "---\ntitle: ok\n  bad: : x\n---\n\nBody",
+			wantLine: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseMarkdown(tt.content)
+			fmErr, ok := err.(*FrontMatterError)
+			if !ok {
+				t.Fatalf("want *FrontMatterError, got %T (%v)", err, err)
+			}
+			if fmErr.Line != tt.wantLine || fmErr.Column != tt.wantColumn {
+				t.Errorf("want %d:%d, got %d:%d", tt.wantLine, tt.wantColumn, fmErr.Line, fmErr.Column)
+			}
+			if fmErr.Message == "" {
+				t.Error("want a message")
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"blog-suiseiseki/metrics"
+)
+
+var (
+	renderCacheHits   = metrics.NewCounter("blog_render_cache_hits_total", "Markdown renders served from the render cache.")
+	renderCacheMisses = metrics.NewCounter("blog_render_cache_misses_total", "Markdown renders not in the render cache.")
+)
+
+// RenderCache keeps the HTML of the most recently rendered Markdown, keyed by its content,
+// so a post is rendered once per version rather than on every request.
+type RenderCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // most recently used first
+	items map[[sha256.Size]byte]*list.Element
+}
+
+type renderEntry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+// NewRenderCache returns a cache holding up to size rendered documents.
+func NewRenderCache(size int) *RenderCache {
+	return &RenderCache{size: size, order: list.New(), items: make(map[[sha256.Size]byte]*list.Element)}
+}
+
+// MarkdownToHTML is MarkdownToHTML served from the cache when the same Markdown was rendered before.
+func (c *RenderCache) MarkdownToHTML(markdown string) (string, error) {
+	key := sha256.Sum256([]byte(markdown))
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		renderCacheHits.Inc()
+		return el.Value.(*renderEntry).html, nil
+	}
+	c.mu.Unlock()
+	renderCacheMisses.Inc()
+
+	html, err := MarkdownToHTML(markdown)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; !ok {
+		c.items[key] = c.order.PushFront(&renderEntry{key: key, html: html})
+		for c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*renderEntry).key)
+		}
+	}
+	return html, nil
+}
+
+// Len returns the number of cached documents.
+func (c *RenderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
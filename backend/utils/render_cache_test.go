@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestRenderCache(t *testing.T) {
+	c := NewRenderCache(2)
+	render := func(md, want string) {
+		t.Helper()
+		html, err := c.MarkdownToHTML(md)
+		if err != nil {
+			t.Fatalf("render %q: %v", md, err)
+		}
+		if html != want {
+			t.Errorf("render %q: want %q, got %q", md, want, html)
+		}
+	}
+
+	render("# a", "<h1>a</h1>\n")
+	render("# b", "<h1>b</h1>\n")
+	render("# a", "<h1>a</h1>\n") // hit; b is now the least recently used
+	render("# c", "<h1>c</h1>\n") // evicts b
+	if c.Len() != 2 {
+		t.Errorf("want 2 cached documents, got %d", c.Len())
+	}
+	for md, want := range map[string]bool{"# a": true, "# b": false, "# c": true} {
+		if _, ok := c.items[sha256.Sum256([]byte(md))]; ok != want {
+			t.Errorf("%q cached: want %v, got %v", md, want, ok)
+		}
+	}
+}
@@ -12,6 +12,8 @@ function App() {
         <Routes>
           <Route path="/" element={<PostsList />} />
           <Route path="/posts/:slug" element={<PostDetail />} />
+          <Route path="/preview/:branch" element={<PostsList />} />
+          <Route path="/preview/:branch/posts/:slug" element={<PostDetail />} />
           <Route path="/resume" element={<Resume />} />
           <Route path="*" element={<NotFound />} />
         </Routes>
@@ -6,3 +6,13 @@ export function apiUrl(path) {
   const p = path.startsWith('/') ? path : `/${path}`
   return `${API_BASE}${p}`
 }
+
+// Posts API root: the live site, or a branch preview (/preview/:branch/... pages)
+export function postsApi(branch) {
+  return branch ? `/api/preview/${encodeURIComponent(branch)}` : '/api'
+}
+
+// Page link root matching postsApi
+export function pagesBase(branch) {
+  return branch ? `/preview/${encodeURIComponent(branch)}` : ''
+}
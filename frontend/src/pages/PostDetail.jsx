@@ -1,12 +1,15 @@
 import { useEffect, useState } from 'react'
 import { useParams, Link } from 'react-router-dom'
-import { apiUrl } from '../api'
+import { apiUrl, postsApi, pagesBase } from '../api'
 
 function PostDetail() {
-  const { slug } = useParams()
+  const { slug, branch } = useParams()
+  const api = postsApi(branch)
+  const home = pagesBase(branch) || '/'
   const [post, setPost] = useState(null)
   const [loading, setLoading] = useState(true)
   const [error, setError] = useState(null)
+  const [version, setVersion] = useState(0)
 
   useEffect(() => {
     if (post?.title) document.title = `${post.title} - Blog`
@@ -14,7 +17,7 @@ function PostDetail() {
   }, [post])
 
   useEffect(() => {
-    fetch(apiUrl(`/api/posts/${slug}`))
+    fetch(apiUrl(`${api}/posts/${slug}`))
       .then((res) => {
         if (!res.ok) {
             throw new Error('Post not found')
@@ -23,13 +26,29 @@ function PostDetail() {
       })
       .then((data) => {
         setPost(data)
+        setError(null)
         setLoading(false)
       })
       .catch((err) => {
         setError(err.message)
         setLoading(false)
       })
-  }, [slug])
+  }, [api, slug, version])
+
+  useEffect(() => {
+    // Reload this post in place when a sync (or the dev file watcher) changes it
+    if (branch) return
+    const es = new EventSource(apiUrl('/api/events'))
+    const onPost = (e) => {
+      if (JSON.parse(e.data).slug === slug) setVersion((v) => v + 1)
+    }
+    for (const type of ['post_created', 'post_updated', 'post_deleted']) {
+      es.addEventListener(type, onPost)
+    }
+    // Missed events could not be replayed after a reconnect
+    es.addEventListener('reset', () => setVersion((v) => v + 1))
+    return () => es.close()
+  }, [branch, slug])
 
   if (loading) {
     return (
@@ -43,7 +62,7 @@ function PostDetail() {
     return (
       <div className="text-center py-12">
         <div className="text-red-500 mb-4">Load failed: {error || 'Post not found'}</div>
-        <Link to="/" className="text-blue-600 hover:text-blue-800">
+        <Link to={home} className="text-blue-600 hover:text-blue-800">
           Back to home
         </Link>
       </div>
@@ -54,11 +73,16 @@ function PostDetail() {
     <article className="bg-white rounded-lg shadow-sm p-8">
       <header className="mb-8 pb-6 border-b">
         <Link
-          to="/"
+          to={home}
           className="text-blue-600 hover:text-blue-800 mb-4 inline-block text-sm"
         >
           ← Back to list
         </Link>
+        {branch && (
+          <span className="ml-3 px-2 py-1 bg-yellow-50 border border-yellow-200 rounded text-xs text-yellow-800">
+            Preview: {branch.replaceAll('~', '/')}
+          </span>
+        )}
         <h1 className="text-4xl font-bold text-gray-900 mb-4">{post.title}</h1>
         <div className="flex items-center space-x-4 text-sm text-gray-600">
           <time dateTime={post.published_at}>
@@ -82,6 +106,20 @@ function PostDetail() {
           lineHeight: '1.8',
         }}
       />
+      {(post.source_url || post.history_url) && (
+        <footer className="mt-8 pt-6 border-t flex space-x-4 text-sm">
+          {post.source_url && (
+            <a href={post.source_url} target="_blank" rel="noopener noreferrer" className="text-blue-600 hover:text-blue-800">
+              Edit this page
+            </a>
+          )}
+          {post.history_url && (
+            <a href={post.history_url} target="_blank" rel="noopener noreferrer" className="text-blue-600 hover:text-blue-800">
+              View history
+            </a>
+          )}
+        </footer>
+      )}
     </article>
   )
 }
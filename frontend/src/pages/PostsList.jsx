@@ -1,10 +1,13 @@
 import { useEffect, useState } from 'react'
-import { Link } from 'react-router-dom'
-import { apiUrl } from '../api'
+import { Link, useParams } from 'react-router-dom'
+import { apiUrl, postsApi, pagesBase } from '../api'
 
 const PAGE_SIZE = 10
 
 function PostsList() {
+  const { branch } = useParams()
+  const api = postsApi(branch)
+  const base = pagesBase(branch)
   const [posts, setPosts] = useState([])
   const [loading, setLoading] = useState(true)
   const [loadingMore, setLoadingMore] = useState(false)
@@ -13,13 +16,13 @@ function PostsList() {
   const [offset, setOffset] = useState(0)
 
   useEffect(() => {
-    document.title = 'Posts - Blog'
-  }, [])
+    document.title = branch ? `Preview: ${branch} - Blog` : 'Posts - Blog'
+  }, [branch])
 
   useEffect(() => {
     setLoading(true)
     setError(null)
-    const url = apiUrl(`/api/posts?limit=${PAGE_SIZE}&offset=0`)
+    const url = apiUrl(`${api}/posts?limit=${PAGE_SIZE}&offset=0`)
     const controller = new AbortController()
     const timeoutId = setTimeout(() => controller.abort(), 10000)
     fetch(url, { signal: controller.signal })
@@ -57,14 +60,22 @@ function PostsList() {
         setError(msg)
         setLoading(false)
       })
-  }, [])
+  }, [api])
 
   useEffect(() => {
+    // Previews are updated by webhook only; the live-site event stream does not cover them
+    if (branch) return
     // SSE: this request stays open (shows as "pending" in DevTools) — that's expected
     const url = apiUrl('/api/events')
     const es = new EventSource(url)
-    es.addEventListener('sync_completed', () => {
-      fetch(apiUrl(`/api/posts?limit=${PAGE_SIZE}&offset=0`))
+    // A sync publishes one event per post and then sync_completed; refetch once they settle
+    let timer
+    const refetch = () => {
+      clearTimeout(timer)
+      timer = setTimeout(load, 200)
+    }
+    const load = () => {
+      fetch(apiUrl(`${api}/posts?limit=${PAGE_SIZE}&offset=0`))
         .then((res) => res.ok ? res.json() : Promise.reject(new Error('refetch failed')))
         .then((data) => {
           const list = data.posts || []
@@ -73,14 +84,20 @@ function PostsList() {
           setHasMore(list.length >= PAGE_SIZE)
         })
         .catch(() => {})
-    })
-    return () => es.close()
-  }, [])
+    }
+    for (const type of ['post_created', 'post_updated', 'post_deleted', 'sync_completed', 'reset']) {
+      es.addEventListener(type, refetch)
+    }
+    return () => {
+      clearTimeout(timer)
+      es.close()
+    }
+  }, [branch, api])
 
   function loadMore() {
     if (loadingMore || !hasMore) return
     setLoadingMore(true)
-    fetch(apiUrl(`/api/posts?limit=${PAGE_SIZE}&offset=${offset}`))
+    fetch(apiUrl(`${api}/posts?limit=${PAGE_SIZE}&offset=${offset}`))
       .then((res) => res.json())
       .then((data) => {
         const list = data.posts || []
@@ -119,6 +136,11 @@ function PostsList() {
 
   return (
     <div>
+      {branch && (
+        <div className="mb-6 px-4 py-2 bg-yellow-50 border border-yellow-200 rounded text-sm text-yellow-800">
+          Preview of branch <code>{branch.replaceAll('~', '/')}</code> — not published yet.
+        </div>
+      )}
       <h1 className="text-3xl font-bold mb-8 text-gray-900">Posts</h1>
       <div className="space-y-6">
         {posts.map((post) => (
@@ -126,7 +148,7 @@ function PostsList() {
             key={post.id}
             className="bg-white rounded-lg shadow-sm p-6 hover:shadow-md transition-shadow"
           >
-            <Link to={`/posts/${post.slug}`}>
+            <Link to={`${base}/posts/${post.slug}`}>
               <h2 className="text-2xl font-semibold text-gray-900 mb-2 hover:text-blue-600 transition-colors">
                 {post.title || 'Untitled'}
               </h2>
@@ -150,7 +172,7 @@ function PostsList() {
                 )}
               </div>
               <Link
-                to={`/posts/${post.slug}`}
+                to={`${base}/posts/${post.slug}`}
                 className="text-blue-600 hover:text-blue-800 font-medium"
               >
                 Read more →